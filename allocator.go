@@ -0,0 +1,246 @@
+package bptree
+
+import (
+	"bytes"
+	"math/bits"
+)
+
+// SlabAllocator makes the tree allocate its nodes from slabs, each of which
+// takes a few allocations for many nodes, and keep the nodes removed from
+// the tree to reuse them for the new ones. The tree with byte-slice keys
+// and values copies them into large chunks of bytes instead of allocating
+// each of them, and keeps the bytes of the deleted keys and values for reuse.
+// So the tree returns the copies of its keys and values, except the values
+// returned by Put and Delete, which are not reused. A chunk stays in memory
+// while any of its keys or values is in the tree. The removed nodes, keys
+// and values are reused only if they are not shared with the snapshots
+// and the versions of the tree, but the iterators must not be used after
+// the tree is changed. Every version returned by With and Without gets its own
+// slabs and chunks, so the versions can be changed from different goroutines.
+// Not supported by the concurrent trees.
+func SlabAllocator() Option {
+	return func(o *options) error {
+		o.slabAllocator = true
+
+		return nil
+	}
+}
+
+const (
+	// the approximate number of keys in the nodes of a slab
+	slabKeyNum = 4096
+
+	// the size of the chunks of the bytes of the keys and the values,
+	// the longer ones are allocated each on its own
+	arenaChunkSize = 64 << 10
+	maxArenaSize   = arenaChunkSize / 16
+
+	// the number of the size classes of the freed bytes up to maxArenaSize
+	arenaClassNum = 13
+)
+
+// allocator allocates the nodes of the tree from the slabs
+// and keeps the removed nodes for reuse.
+type allocator[K, V any] struct {
+	order int
+
+	// the number of nodes in a slab
+	slabSize int
+
+	// the rest of the current slabs of the nodes and their slices
+	nodes    []node[K, V]
+	keys     []K
+	values   []V
+	children []*node[K, V]
+
+	// the removed leaves and internal nodes
+	leaves    []*node[K, V]
+	internals []*node[K, V]
+
+	// keeps the bytes of the keys and the values of the tree
+	// with byte-slice keys and values, nil for the other trees
+	arena *arena
+}
+
+// newAllocator returns the allocator of the nodes of the given order.
+func newAllocator[K, V any](order int) *allocator[K, V] {
+	return &allocator[K, V]{order: order, slabSize: max(slabKeyNum/order, 1)}
+}
+
+// allocate returns an empty node, the removed one if there is any.
+func (a *allocator[K, V]) allocate(leaf bool) *node[K, V] {
+	free := &a.internals
+	if leaf {
+		free = &a.leaves
+	}
+
+	if last := len(*free) - 1; last >= 0 {
+		n := (*free)[last]
+		(*free)[last] = nil
+		*free = (*free)[:last]
+
+		return n
+	}
+
+	if len(a.nodes) == 0 {
+		a.nodes = make([]node[K, V], a.slabSize)
+	}
+
+	n := &a.nodes[0]
+	a.nodes = a.nodes[1:]
+
+	n.leaf = leaf
+	n.keys = carve(&a.keys, a.order-1, a.slabSize)
+	if leaf {
+		n.values = carve(&a.values, a.order-1, a.slabSize)
+	} else {
+		n.children = carve(&a.children, a.order, a.slabSize)
+	}
+
+	return n
+}
+
+// release keeps the node removed from the tree for reuse. The node is cleared,
+// so it does not keep its keys, values and children in memory.
+func (a *allocator[K, V]) release(n *node[K, V]) {
+	clear(n.keys)
+	clear(n.values)
+	clear(n.children)
+	n.keyNum = 0
+	if n.state != nil {
+		n.state.prefix, n.state.count = nil, 0
+	}
+
+	if n.leaf {
+		a.leaves = append(a.leaves, n)
+	} else {
+		a.internals = append(a.internals, n)
+	}
+}
+
+// carve cuts the slice of the length off the slab. The exhausted slab
+// is replaced by the new one for the given number of slices.
+func carve[T any](slab *[]T, length, count int) []T {
+	if len(*slab) < length {
+		*slab = make([]T, length*count)
+	}
+
+	s := (*slab)[:length:length]
+	*slab = (*slab)[length:]
+
+	return s
+}
+
+// arena keeps the bytes of the keys and the values in large chunks,
+// and the freed bytes in the free lists of their size classes for reuse.
+type arena struct {
+	// the rest of the current chunk
+	chunk []byte
+
+	// the freed bytes, the capacity of the bytes of the class i is at least 1<<i
+	freed [arenaClassNum][][]byte
+}
+
+// copy copies the bytes into the arena. The capacity of the copy is the size
+// of its class, so it can be freed, but the extra bytes are not used.
+func (a *arena) copy(b []byte) []byte {
+	if len(b) == 0 || len(b) > maxArenaSize {
+		return bytes.Clone(b)
+	}
+
+	class := bits.Len(uint(len(b) - 1))
+
+	var c []byte
+	if freed := a.freed[class]; len(freed) > 0 {
+		c = freed[len(freed)-1]
+		freed[len(freed)-1] = nil
+		a.freed[class] = freed[:len(freed)-1]
+	} else {
+		if len(a.chunk) < 1<<class {
+			a.chunk = make([]byte, arenaChunkSize)
+		}
+
+		c = a.chunk[: 0 : 1<<class]
+		a.chunk = a.chunk[1<<class:]
+	}
+
+	return append(c, b...)
+}
+
+// free keeps the bytes that are not used anymore for reuse.
+// The bytes do not have to be copied into the arena.
+func (a *arena) free(b []byte) {
+	if cap(b) == 0 || cap(b) > maxArenaSize {
+		return
+	}
+
+	// the bytes fit into the largest class not larger than them
+	class := bits.Len(uint(cap(b))) - 1
+	a.freed[class] = append(a.freed[class], b[:0])
+}
+
+// reusableArena returns the arena of the tree that reuses the freed bytes,
+// nil if the tree has no arena or if it shares its nodes with a snapshot
+// or a version, since the shared nodes might still refer to the bytes.
+func (t *Tree[K, V]) reusableArena() *arena {
+	if t.allocator == nil || t.generation != 0 {
+		return nil
+	}
+
+	return t.allocator.arena
+}
+
+// storedValue returns the value the way it is stored in the tree.
+func (t *Tree[K, V]) storedValue(value V) V {
+	if t.allocator == nil || t.allocator.arena == nil {
+		return value
+	}
+
+	return keyOf[V](t.allocator.arena.copy(bytesOf(value)))
+}
+
+// freeKey keeps the bytes of the key removed from the tree for reuse.
+func (t *Tree[K, V]) freeKey(key K) {
+	if a := t.reusableArena(); a != nil {
+		a.free(bytesOf(key))
+	}
+}
+
+// freeValue keeps the bytes of the value removed from the tree for reuse.
+func (t *Tree[K, V]) freeValue(value V) {
+	if a := t.reusableArena(); a != nil {
+		a.free(bytesOf(value))
+	}
+}
+
+// indexKey returns the key of the leaf to keep in the internal nodes.
+// The arena reuses the bytes of the keys deleted from the leaves,
+// so the internal nodes keep the copies of them then.
+func (t *Tree[K, V]) indexKey(key K) K {
+	if !t.copiesOut() {
+		return key
+	}
+
+	return cloneBytes(key)
+}
+
+// copiesOut returns true if the tree returns the copies of its keys and values,
+// since the arena reuses their bytes after they are deleted.
+func (t *Tree[K, V]) copiesOut() bool {
+	return t.allocator != nil && t.allocator.arena != nil
+}
+
+// copyOut returns the key and the value found in the tree, or their copies
+// if the tree copies them out.
+func (t *Tree[K, V]) copyOut(key K, value V, ok bool) (K, V, bool) {
+	if ok && t.copiesOut() {
+		return cloneBytes(key), cloneBytes(value), true
+	}
+
+	return key, value, ok
+}
+
+// cloneBytes returns the copy of the byte-slice key or value.
+func cloneBytes[T any](x T) T {
+	return keyOf[T](bytes.Clone(bytesOf(x)))
+}
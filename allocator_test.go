@@ -0,0 +1,283 @@
+package bptree
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"sync"
+	"testing"
+)
+
+func ExampleSlabAllocator() {
+	tree, _ := New(SlabAllocator())
+
+	tree.Put([]byte("apple"), []byte("red"))
+	tree.Delete([]byte("apple"))
+	tree.Put([]byte("banana"), []byte("yellow"))
+
+	value, _ := tree.Get([]byte("banana"))
+	fmt.Printf("banana = %s\n", value)
+	// Output:
+	// banana = yellow
+}
+
+func TestSlabAllocatorErrors(t *testing.T) {
+	if _, err := NewConcurrent(SlabAllocator()); err == nil {
+		t.Fatal("expected the error for the concurrent tree")
+	}
+	if _, err := NewBLink(SlabAllocator()); err == nil {
+		t.Fatal("expected the error for the B-link tree")
+	}
+}
+
+func TestSlabAllocatorRandomized(t *testing.T) {
+	for order := 3; order <= 7; order++ {
+		for _, options := range [][]Option{{}, {Counted()}, {PrefixCompression()}, {Comparator(bytes.Compare)}, {MemoryLimit(4096), PageSize(128)}} {
+			tree, err := New(append(options, Order(order), SlabAllocator())...)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			expected := make(map[string][]byte)
+			var snapshot *Snapshot
+			var snapshotted map[string][]byte
+
+			r := rand.New(rand.NewSource(int64(order)))
+			for i := 0; i < 5000; i++ {
+				key := r.Intn(500)
+				switch r.Intn(10) {
+				case 0:
+					end := key + r.Intn(100)
+					tree.DeleteRange(rankKey(key), rankKey(end))
+					for k := key; k < end; k++ {
+						delete(expected, string(rankKey(k)))
+					}
+				case 1, 2, 3, 4:
+					tree.Delete(rankKey(key))
+					delete(expected, string(rankKey(key)))
+				default:
+					tree.Put(rankKey(key), rankKey(i))
+					expected[string(rankKey(key))] = rankKey(i)
+				}
+
+				// the nodes shared with the snapshot must not be reused
+				if tree.store == nil && i == 2500 {
+					snapshot, _ = tree.Snapshot()
+					snapshotted = clone(expected)
+				}
+			}
+
+			assertContents(t, tree, expected)
+
+			for key, value := range snapshotted {
+				if actual, ok := snapshot.Get([]byte(key)); !ok || !bytes.Equal(actual, value) {
+					t.Fatalf("expected %v for %v in the snapshot, but got %v", value, []byte(key), actual)
+				}
+			}
+
+			if err := tree.Close(); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+}
+
+func TestSlabAllocatorVersions(t *testing.T) {
+	tree, _ := NewTree[int, int](Order(3), SlabAllocator())
+	for i := 0; i < 1000; i++ {
+		tree.Put(i, i)
+	}
+
+	// the versions are changed from different goroutines,
+	// so each of them has its own allocator
+	with, _ := tree.With(-1, -1)
+	without, _ := tree.Without(0)
+	versions := []*Tree[int, int]{tree, with, without}
+	if versions[1].allocator == tree.allocator || versions[2].allocator == tree.allocator {
+		t.Fatal("expected the versions to have their own allocators")
+	}
+
+	var wg sync.WaitGroup
+	for v, version := range versions {
+		wg.Add(1)
+		go func(v int, version *Tree[int, int]) {
+			defer wg.Done()
+
+			for i := 0; i < 1000; i++ {
+				version.Delete(i)
+			}
+			for i := 0; i < 1000; i++ {
+				version.Put(i, i*v)
+			}
+		}(v, version)
+	}
+	wg.Wait()
+
+	for v, version := range versions {
+		for i := 0; i < 1000; i++ {
+			if value, ok := version.Get(i); !ok || value != i*v {
+				t.Fatalf("expected %d for %d in the version %d, but got %d", i*v, i, v, value)
+			}
+		}
+		assertInvariants(t, version)
+	}
+}
+
+func TestSlabAllocatorReusesNodes(t *testing.T) {
+	tree, _ := NewTree[int, int](Order(3), SlabAllocator())
+	for i := 0; i < 100; i++ {
+		tree.Put(i, i)
+	}
+	for i := 0; i < 100; i++ {
+		tree.Delete(i)
+	}
+
+	a := tree.allocator
+	released := len(a.leaves) + len(a.internals)
+	if released == 0 {
+		t.Fatal("expected the removed nodes to be kept for reuse")
+	}
+	for _, n := range append(a.leaves, a.internals...) {
+		if n.keyNum != 0 || n.keys[0] != 0 || (n.leaf && n.values[0] != 0) || (!n.leaf && n.children[0] != nil) {
+			t.Fatalf("expected the released node to be cleared, but got %+v", n)
+		}
+	}
+
+	for i := 0; i < 100; i++ {
+		tree.Put(i, i)
+	}
+	if len(a.leaves)+len(a.internals) >= released {
+		t.Fatal("expected the removed nodes to be reused")
+	}
+
+	assertInvariants(t, tree)
+}
+
+func TestSlabAllocatorCopiesKeysAndValues(t *testing.T) {
+	for _, options := range [][]Option{{}, {Comparator(bytes.Compare)}} {
+		tree, _ := New(append(options, Order(3), SlabAllocator())...)
+
+		key, value := []byte("apple"), []byte("red")
+		tree.Put(key, value)
+		key[0], value[0] = 'A', 'R'
+
+		assertContents(t, tree, map[string][]byte{"apple": []byte("red")})
+
+		// the tree returns the copies of its keys and values,
+		// since their bytes are reused after they are deleted
+		tree.Put([]byte("banana"), []byte("yellow"))
+		tree.Put([]byte("cherry"), []byte("dark red"))
+		got, _ := tree.Get([]byte("cherry"))
+		tree.DeleteRange([]byte("cherry"), []byte("d"))
+		first, firstValue, _ := tree.Min()
+		atKey, atValue, _ := tree.At(1)
+		it := tree.Iterator()
+		itKey, itValue := it.Next()
+		popped, poppedValue, _ := tree.PopMax()
+		deleted, _ := tree.Delete([]byte("apple"))
+		for i := 0; i < 100; i++ {
+			// the freed bytes of all classes are reused
+			b := bytes.Repeat([]byte{byte('a' + i%26)}, 1+i%8)
+			tree.Put(b, b)
+		}
+
+		for _, c := range []struct{ actual, expected string }{
+			{string(got), "dark red"},
+			{string(first), "apple"},
+			{string(firstValue), "red"},
+			{string(atKey), "banana"},
+			{string(atValue), "yellow"},
+			{string(itKey), "apple"},
+			{string(itValue), "red"},
+			{string(popped), "banana"},
+			{string(poppedValue), "yellow"},
+			{string(deleted), "red"},
+		} {
+			if c.actual != c.expected {
+				t.Fatalf("expected the returned bytes to be kept as %s, but got %s", c.expected, c.actual)
+			}
+		}
+
+		// the versions are changed from different goroutines,
+		// so each of them has its own arena
+		if version, _ := tree.With([]byte("apple"), nil); version.allocator.arena == nil || version.allocator.arena == tree.allocator.arena {
+			t.Fatal("expected the version to have its own arena")
+		}
+	}
+}
+
+func TestArena(t *testing.T) {
+	a := &arena{}
+
+	short := a.copy([]byte("apple"))
+	if string(short) != "apple" || cap(short) != 8 {
+		t.Fatalf("expected apple in 8 bytes, but got %s in %d bytes", short, cap(short))
+	}
+
+	// the bytes of the class are reused
+	a.free(short)
+	if reused := a.copy([]byte("melon")); &reused[0] != &short[0] {
+		t.Fatal("expected the freed bytes to be reused")
+	}
+
+	// the bytes of any capacity fit into the largest class not larger than them
+	a.free(make([]byte, 0, 12))
+	if len(a.freed[3]) != 1 {
+		t.Fatalf("expected the bytes in the class 3, but got %v", a.freed)
+	}
+
+	// the empty and the long bytes are not kept in the arena
+	long := bytes.Repeat([]byte{'x'}, maxArenaSize+1)
+	for _, b := range [][]byte{nil, {}, long} {
+		c := a.copy(b)
+		if !bytes.Equal(c, b) || (c == nil) != (b == nil) {
+			t.Fatalf("expected %v, but got %v", b, c)
+		}
+		a.free(c)
+	}
+
+	// the chunk is replaced when the bytes do not fit into it
+	a = &arena{}
+	for i := 0; i < arenaChunkSize/maxArenaSize+1; i++ {
+		a.copy(long[:maxArenaSize])
+	}
+	if len(a.chunk) != arenaChunkSize-maxArenaSize {
+		t.Fatalf("expected the new chunk, but %d bytes are left", len(a.chunk))
+	}
+}
+
+func BenchmarkTreeChurn(b *testing.B) {
+	for _, c := range []struct {
+		name    string
+		options []Option
+	}{
+		{"allocator=default", nil},
+		{"allocator=slab", []Option{SlabAllocator()}},
+	} {
+		b.Run(c.name, func(b *testing.B) {
+			keys := make([][]byte, benchmarkKeyNum)
+			BenchmarkTree, _ = New(append(c.options, Order(16))...)
+			for k := range keys {
+				keys[k] = rankKey(k)
+				BenchmarkTree.Put(keys[k], nil)
+			}
+
+			r := rand.New(rand.NewSource(0))
+
+			b.ReportAllocs()
+			b.ResetTimer()
+
+			// the batches of the keys are deleted and put back,
+			// so the nodes are merged and split
+			for n := 0; n < b.N; n++ {
+				start := r.Intn(benchmarkKeyNum - 1000)
+				for _, key := range keys[start : start+1000] {
+					BenchmarkTree.Delete(key)
+				}
+				for _, key := range keys[start : start+1000] {
+					BenchmarkTree.Put(key, nil)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,519 @@
+package bptree
+
+import (
+	"cmp"
+	"fmt"
+	"sync"
+	"sync/atomic"
+)
+
+// BLinkBPTree is a B-link tree with byte-slice keys and values.
+type BLinkBPTree struct {
+	*BLinkTree[[]byte, []byte]
+}
+
+// NewBLink returns a new instance of the B-link tree with byte-slice keys and values.
+// The counted mode is not supported.
+func NewBLink(options ...Option) (*BLinkBPTree, error) {
+	o, err := newInMemoryOptions(options)
+	if err != nil {
+		return nil, err
+	}
+
+	t, err := newBytesTree(o)
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := newBLinkTree(t)
+	if err != nil {
+		return nil, err
+	}
+
+	return &BLinkBPTree{b}, nil
+}
+
+// NewBLinkTree returns a new instance of the B-link tree with ordered keys
+// of type K and values of type V.
+func NewBLinkTree[K cmp.Ordered, V any](options ...Option) (*BLinkTree[K, V], error) {
+	t, err := NewTree[K, V](options...)
+	if err != nil {
+		return nil, err
+	}
+
+	return newBLinkTree(t)
+}
+
+// NewBLinkTreeFunc returns a new instance of the B-link tree with keys of any type
+// ordered by the given comparator.
+func NewBLinkTreeFunc[K, V any](compare func(x, y K) int, options ...Option) (*BLinkTree[K, V], error) {
+	t, err := NewTreeFunc[K, V](compare, options...)
+	if err != nil {
+		return nil, err
+	}
+
+	return newBLinkTree(t)
+}
+
+// BLinkTree is a goroutine-safe B+ tree in which readers never block writers,
+// as in the B-link tree of Lehman and Yao.
+//
+// Every node carries a link to its right sibling and a high key, the upper bound
+// of the keys in its subtree. A split moves the upper half of the node to the new
+// right sibling and links it before the separator reaches the parent, so
+// a reader that arrives at the node while the parent still points to it sees
+// that the key is not less than the high key and moves right. Readers take
+// no latches at all: writers never change the state of a node in place,
+// but replace it atomically, so readers always see a consistent node.
+// Writers latch one node at a time, except the splits that latch the parent
+// before releasing the child.
+//
+// Nodes are never merged, so the nodes emptied by Delete stay in the tree
+// until new keys are put into them.
+type BLinkTree[K, V any] struct {
+	root atomic.Pointer[blinkNode[K, V]]
+
+	// serializes the replacement of the root
+	rootLatch sync.Mutex
+
+	// The order or branching factor of the tree.
+	order int
+
+	// the number of keys in the tree
+	size atomic.Int64
+
+	// compares the keys and defines their order in the tree
+	compare func(x, y K) int
+
+	// copies the key before it is stored in the tree,
+	// nil if the keys are stored as they are
+	copyKey func(key K) K
+}
+
+// newBLinkTree returns a new instance of the B-link tree
+// configured as the given empty tree.
+func newBLinkTree[K, V any](t *Tree[K, V]) (*BLinkTree[K, V], error) {
+	if t.counted {
+		return nil, fmt.Errorf("counted mode is not supported by the B-link tree")
+	}
+	if t.prefixCompression {
+		return nil, fmt.Errorf("prefix compression is not supported by the B-link tree")
+	}
+	if t.allocator != nil {
+		return nil, fmt.Errorf("slab allocator is not supported by the B-link tree")
+	}
+
+	b := &BLinkTree[K, V]{order: t.order, compare: t.compare, copyKey: t.copyKey}
+	b.root.Store(newBLinkNode(0, &blinkState[K, V]{}))
+
+	return b, nil
+}
+
+// Get returns a value by the key. The second return
+// value is a flag that determines if the key was found.
+func (t *BLinkTree[K, V]) Get(key K) (V, bool) {
+	_, s := t.findLeaf(key)
+
+	position, found := t.search(s.keys, key)
+	if !found {
+		var zero V
+		return zero, false
+	}
+
+	return s.values[position], true
+}
+
+// Put inserts the value into the tree. If the key already exists,
+// it overrides it.
+// Returns true and the previous value if the value has been overridden,
+// otherwise false.
+func (t *BLinkTree[K, V]) Put(key K, value V) (V, bool) {
+	// the rightmost visited node on every level above the leaf,
+	// the parent of the leaf is the last one
+	ancestors := make([]*blinkNode[K, V], 0)
+
+	n := t.root.Load()
+	for n.level > 0 {
+		s := n.state.Load()
+		if t.beyond(s, key) {
+			n = s.right
+			continue
+		}
+
+		ancestors = append(ancestors, n)
+		n = s.children[t.childPosition(s.keys, key)]
+	}
+
+	n.latch.Lock()
+	n, s := t.moveRight(n, key)
+
+	position, found := t.search(s.keys, key)
+	if found {
+		next := s.clone()
+		next.values[position] = value
+		n.state.Store(next)
+		n.latch.Unlock()
+
+		return s.values[position], true
+	}
+
+	t.size.Add(1)
+
+	keys := withInserted(s.keys, position, t.storedKey(key))
+	values := withInserted(s.values, position, value)
+	if len(keys) < t.order {
+		n.state.Store(&blinkState[K, V]{keys: keys, values: values, high: s.high, bounded: s.bounded, right: s.right})
+		n.latch.Unlock()
+
+		var zero V
+		return zero, false
+	}
+
+	// the leaf is split into the left and the right halves
+	middle := len(keys) / 2
+	right := newBLinkNode(0, &blinkState[K, V]{
+		keys:    keys[middle:],
+		values:  values[middle:],
+		high:    s.high,
+		bounded: s.bounded,
+		right:   s.right,
+	})
+	separator := keys[middle]
+	n.state.Store(&blinkState[K, V]{
+		keys:    keys[:middle:middle],
+		values:  values[:middle:middle],
+		high:    separator,
+		bounded: true,
+		right:   right,
+	})
+
+	t.putIntoParent(ancestors, n, separator, right)
+
+	var zero V
+	return zero, false
+}
+
+// putIntoParent inserts the separator and the pointer to the right node
+// split from the latched left node into the parent, which is latched
+// before the left node is released. The parent is split if it is full.
+func (t *BLinkTree[K, V]) putIntoParent(ancestors []*blinkNode[K, V], left *blinkNode[K, V], separator K, right *blinkNode[K, V]) {
+	for {
+		var parent *blinkNode[K, V]
+		if len(ancestors) > 0 {
+			parent, ancestors = ancestors[len(ancestors)-1], ancestors[:len(ancestors)-1]
+		} else {
+			t.rootLatch.Lock()
+			if t.root.Load() == left {
+				// the root is split, so the tree grows
+				t.root.Store(newBLinkNode(left.level+1, &blinkState[K, V]{
+					keys:     []K{separator},
+					children: []*blinkNode[K, V]{left, right},
+				}))
+				t.rootLatch.Unlock()
+				left.latch.Unlock()
+
+				return
+			}
+			t.rootLatch.Unlock()
+
+			// the root has been split after the left node was visited
+			parent = t.findAtLevel(separator, left.level+1)
+		}
+
+		parent.latch.Lock()
+		parent, s := t.moveRight(parent, separator)
+		left.latch.Unlock()
+
+		position := t.childPosition(s.keys, separator)
+		keys := withInserted(s.keys, position, separator)
+		children := withInserted(s.children, position+1, right)
+		if len(keys) < t.order {
+			parent.state.Store(&blinkState[K, V]{keys: keys, children: children, high: s.high, bounded: s.bounded, right: s.right})
+			parent.latch.Unlock()
+
+			return
+		}
+
+		// the parent is split and the middle key moves up
+		middle := len(keys) / 2
+		parentRight := newBLinkNode(parent.level, &blinkState[K, V]{
+			keys:     keys[middle+1:],
+			children: children[middle+1:],
+			high:     s.high,
+			bounded:  s.bounded,
+			right:    s.right,
+		})
+		separator = keys[middle]
+		parent.state.Store(&blinkState[K, V]{
+			keys:     keys[:middle:middle],
+			children: children[: middle+1 : middle+1],
+			high:     separator,
+			bounded:  true,
+			right:    parentRight,
+		})
+
+		left, right = parent, parentRight
+	}
+}
+
+// Delete deletes the key from the tree. Returns deleted value and true
+// if the key exists, otherwise nil and false.
+func (t *BLinkTree[K, V]) Delete(key K) (V, bool) {
+	n, _ := t.findLeaf(key)
+
+	n.latch.Lock()
+	n, s := t.moveRight(n, key)
+	defer n.latch.Unlock()
+
+	position, found := t.search(s.keys, key)
+	if !found {
+		var zero V
+		return zero, false
+	}
+
+	n.state.Store(&blinkState[K, V]{
+		keys:    withDeleted(s.keys, position),
+		values:  withDeleted(s.values, position),
+		high:    s.high,
+		bounded: s.bounded,
+		right:   s.right,
+	})
+	t.size.Add(-1)
+
+	return s.values[position], true
+}
+
+// Size return the size of the tree.
+func (t *BLinkTree[K, V]) Size() int {
+	return int(t.size.Load())
+}
+
+// ForEach traverses tree in ascending key order.
+// See BLinkIterator for the guarantees.
+func (t *BLinkTree[K, V]) ForEach(action func(key K, value V)) {
+	for it := t.Iterator(); it.HasNext(); {
+		key, value := it.Next()
+		action(key, value)
+	}
+}
+
+// findLeaf returns the leaf that contains the key if it is present
+// and the state of the leaf, moving right if the node has been split.
+func (t *BLinkTree[K, V]) findLeaf(key K) (*blinkNode[K, V], *blinkState[K, V]) {
+	n := t.root.Load()
+	for {
+		s := n.state.Load()
+		if t.beyond(s, key) {
+			n = s.right
+		} else if n.level == 0 {
+			return n, s
+		} else {
+			n = s.children[t.childPosition(s.keys, key)]
+		}
+	}
+}
+
+// findAtLevel returns the node at the level that might contain the key.
+func (t *BLinkTree[K, V]) findAtLevel(key K, level int) *blinkNode[K, V] {
+	n := t.root.Load()
+	for {
+		s := n.state.Load()
+		if t.beyond(s, key) {
+			n = s.right
+		} else if n.level == level {
+			return n
+		} else {
+			n = s.children[t.childPosition(s.keys, key)]
+		}
+	}
+}
+
+// moveRight moves right from the latched node until it finds the node
+// that might contain the key, latches it and releases the previous one.
+func (t *BLinkTree[K, V]) moveRight(n *blinkNode[K, V], key K) (*blinkNode[K, V], *blinkState[K, V]) {
+	s := n.state.Load()
+	for t.beyond(s, key) {
+		right := s.right
+		right.latch.Lock()
+		n.latch.Unlock()
+
+		n, s = right, right.state.Load()
+	}
+
+	return n, s
+}
+
+// beyond returns true if the key is not less than the high key of the node,
+// so the key has been moved to the right sibling.
+func (t *BLinkTree[K, V]) beyond(s *blinkState[K, V], key K) bool {
+	return s.bounded && t.compare(key, s.high) >= 0
+}
+
+// search returns the position of the key in the sorted keys
+// or the position to insert it and false if it is not present.
+func (t *BLinkTree[K, V]) search(keys []K, key K) (int, bool) {
+	return search(keys, key, t.compare)
+}
+
+// childPosition returns the position of the child of the internal node
+// with the given keys that might contain the key.
+func (t *BLinkTree[K, V]) childPosition(keys []K, key K) int {
+	position, found := search(keys, key, t.compare)
+	if found {
+		position++
+	}
+
+	return position
+}
+
+// storedKey returns the key the way it is stored in the tree.
+func (t *BLinkTree[K, V]) storedKey(key K) K {
+	if t.copyKey == nil {
+		return key
+	}
+
+	return t.copyKey(key)
+}
+
+// blinkNode is a node of the B-link tree.
+type blinkNode[K, V any] struct {
+	// 0 for the leaf nodes and the height above the leaves for the internal nodes
+	level int
+
+	// the current state, replaced as a whole by the writers
+	state atomic.Pointer[blinkState[K, V]]
+
+	// serializes the writers of the node, readers do not take it
+	latch sync.Mutex
+}
+
+// newBLinkNode returns a new node at the level with the given state.
+func newBLinkNode[K, V any](level int, s *blinkState[K, V]) *blinkNode[K, V] {
+	n := &blinkNode[K, V]{level: level}
+	n.state.Store(s)
+
+	return n
+}
+
+// blinkState is the immutable state of the node.
+type blinkState[K, V any] struct {
+	keys []K
+
+	// the children of the internal node, one more than the keys
+	children []*blinkNode[K, V]
+
+	// the values of the leaf node
+	values []V
+
+	// The high key is the upper bound of the keys in the subtree.
+	// The rightmost node on every level is not bounded.
+	high    K
+	bounded bool
+
+	// the right sibling on the same level, nil for the rightmost node
+	right *blinkNode[K, V]
+}
+
+// clone returns a copy of the state of the leaf with its own values.
+func (s *blinkState[K, V]) clone() *blinkState[K, V] {
+	c := *s
+	c.values = append([]V(nil), s.values...)
+
+	return &c
+}
+
+// withInserted returns a copy of the slice with the element inserted at the position.
+func withInserted[T any](s []T, position int, e T) []T {
+	c := make([]T, len(s)+1)
+	copy(c, s[:position])
+	c[position] = e
+	copy(c[position+1:], s[position:])
+
+	return c
+}
+
+// withDeleted returns a copy of the slice without the element at the position.
+func withDeleted[T any](s []T, position int) []T {
+	c := make([]T, len(s)-1)
+	copy(c, s[:position])
+	copy(c[position:], s[position+1:])
+
+	return c
+}
+
+// Iterator returns a stateful iterator that traverses the tree
+// in ascending key order.
+func (t *BLinkTree[K, V]) Iterator() *BLinkIterator[K, V] {
+	n := t.root.Load()
+	for n.level > 0 {
+		n = n.state.Load().children[0]
+	}
+
+	return &BLinkIterator[K, V]{tree: t, next: n, inclusive: true}
+}
+
+// Seek returns a stateful iterator that traverses the keys
+// greater than or equal to the given key in ascending key order.
+func (t *BLinkTree[K, V]) Seek(key K) *BLinkIterator[K, V] {
+	n, _ := t.findLeaf(key)
+
+	return &BLinkIterator[K, V]{tree: t, next: n, from: &key, inclusive: true}
+}
+
+// BLinkIterator traverses the B-link tree in ascending key order following
+// the right links of the leaves. It never takes latches and never blocks writers.
+// The iteration is weakly consistent: every key is returned at most once
+// and in ascending order, the keys that are present during the whole iteration
+// are always returned, and the keys that are put or deleted during
+// the iteration might be returned or not.
+type BLinkIterator[K, V any] struct {
+	tree *BLinkTree[K, V]
+
+	// the current state of the leaf and the position in it
+	state *blinkState[K, V]
+	i     int
+
+	// the next leaf to load, nil after the rightmost one
+	next *blinkNode[K, V]
+
+	// the key to continue from, nil for the beginning of the tree
+	from      *K
+	inclusive bool
+}
+
+// HasNext returns true if there is a next element to iterate.
+func (it *BLinkIterator[K, V]) HasNext() bool {
+	for (it.state == nil || it.i == len(it.state.keys)) && it.next != nil {
+		it.state, it.i = it.next.state.Load(), 0
+		it.next = it.state.right
+
+		// the leaf might contain the keys returned before
+		// if it has been split since the previous leaf was loaded
+		for it.from != nil && it.i < len(it.state.keys) {
+			c := it.tree.compare(it.state.keys[it.i], *it.from)
+			if c > 0 || c == 0 && it.inclusive {
+				break
+			}
+
+			it.i++
+		}
+	}
+
+	return it.state != nil && it.i < len(it.state.keys)
+}
+
+// Next returns a key and a value at the current position of the iteration
+// and advances the iterator.
+// Caution! Next panics if called on the nil element.
+func (it *BLinkIterator[K, V]) Next() (K, V) {
+	if !it.HasNext() {
+		// to sleep well
+		panic("there is no next node")
+	}
+
+	key, value := it.state.keys[it.i], it.state.values[it.i]
+	it.i++
+	it.from, it.inclusive = &key, false
+
+	return key, value
+}
@@ -0,0 +1,416 @@
+package bptree
+
+import (
+	"bytes"
+	"cmp"
+	"fmt"
+	"math/rand"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+func ExampleNewBLink() {
+	tree, _ := NewBLink()
+
+	tree.Put([]byte("apple"), []byte("sweet"))
+	tree.Put([]byte("banana"), []byte("honey"))
+	tree.Put([]byte("cinnamon"), []byte("savoury"))
+
+	for it := tree.Iterator(); it.HasNext(); {
+		key, value := it.Next()
+		fmt.Printf("key = %s, value = %s\n", string(key), string(value))
+	}
+
+	// Output:
+	// key = apple, value = sweet
+	// key = banana, value = honey
+	// key = cinnamon, value = savoury
+}
+
+func TestNewBLinkErrors(t *testing.T) {
+	_, err := NewBLink(Order(2))
+	if err == nil {
+		t.Fatal("must return an error for the order, but it does not")
+	}
+
+	_, err = NewBLinkTree[int, int](Counted())
+	if err == nil {
+		t.Fatal("must return an error for the counted mode, but it does not")
+	}
+
+	_, err = NewBLinkTree[int, int](Order(2))
+	if err == nil {
+		t.Fatal("must return an error for the order, but it does not")
+	}
+
+	_, err = NewBLink(Comparator(cmp.Compare[int]))
+	if err == nil {
+		t.Fatal("must return an error for the comparator, but it does not")
+	}
+
+	_, err = NewBLinkTreeFunc[int, int](nil)
+	if err == nil {
+		t.Fatal("must return an error for the comparator, but it does not")
+	}
+}
+
+func TestBLinkTreeFunc(t *testing.T) {
+	tree, _ := NewBLinkTreeFunc[int, int](func(x, y int) int {
+		return y - x
+	}, Order(3))
+	for i := 0; i < 10; i++ {
+		tree.Put(i, i)
+	}
+
+	keys := make([]int, 0)
+	tree.ForEach(func(key, value int) {
+		keys = append(keys, key)
+	})
+	if !reflect.DeepEqual(keys, []int{9, 8, 7, 6, 5, 4, 3, 2, 1, 0}) {
+		t.Fatalf("unexpected keys %v", keys)
+	}
+}
+
+func TestBLinkPutGetAndDeleteRandomized(t *testing.T) {
+	for order := 3; order <= 7; order++ {
+		tree, _ := NewBLinkTree[int, int](Order(order))
+		expected := make(map[int]int)
+
+		r := rand.New(rand.NewSource(int64(order)))
+		for i := 0; i < 3000; i++ {
+			key := r.Intn(300)
+			switch r.Intn(3) {
+			case 0:
+				value, ok := tree.Delete(key)
+				expectedValue, expectedOK := expected[key]
+				if value != expectedValue || ok != expectedOK {
+					t.Fatalf("deleted %d, %v, but expected %d, %v", value, ok, expectedValue, expectedOK)
+				}
+				delete(expected, key)
+			case 1:
+				value, ok := tree.Put(key, i)
+				expectedValue, expectedOK := expected[key]
+				if value != expectedValue || ok != expectedOK {
+					t.Fatalf("overridden %d, %v, but expected %d, %v", value, ok, expectedValue, expectedOK)
+				}
+				expected[key] = i
+			default:
+				value, ok := tree.Get(key)
+				expectedValue, expectedOK := expected[key]
+				if value != expectedValue || ok != expectedOK {
+					t.Fatalf("got %d, %v, but expected %d, %v", value, ok, expectedValue, expectedOK)
+				}
+			}
+		}
+
+		assertBLinkInvariants(t, tree)
+
+		keys := make([]int, 0, len(expected))
+		for key := range expected {
+			keys = append(keys, key)
+		}
+		sort.Ints(keys)
+
+		actual := make([]int, 0)
+		tree.ForEach(func(key, value int) {
+			if value != expected[key] {
+				t.Fatalf("expected %d for %d, but got %d", expected[key], key, value)
+			}
+			actual = append(actual, key)
+		})
+		if !reflect.DeepEqual(keys, actual) {
+			t.Fatalf("%v != %v", keys, actual)
+		}
+
+		sought := make([]int, 0)
+		for it := tree.Seek(150); it.HasNext(); {
+			key, _ := it.Next()
+			sought = append(sought, key)
+		}
+		if start := sort.SearchInts(keys, 150); !reflect.DeepEqual(keys[start:], sought) {
+			t.Fatalf("%v != %v", keys[start:], sought)
+		}
+	}
+}
+
+func TestBLinkIteratorPanics(t *testing.T) {
+	tree, _ := NewBLinkTree[int, int]()
+
+	it := tree.Iterator()
+	defer func() {
+		if r := recover(); r == nil {
+			t.Error("Next must panic on the empty tree")
+		}
+	}()
+	it.Next()
+}
+
+// TestBLinkMoveRight splits the nodes, but does not put the separators into
+// the parents yet, as if the writers were interrupted in the middle of the splits.
+func TestBLinkMoveRight(t *testing.T) {
+	tree, _ := NewBLinkTree[int, int](Order(4))
+	for i := 0; i < 200; i++ {
+		tree.Put(2*i, 2*i)
+	}
+
+	parent := tree.findAtLevel(100, 1)
+	parentSeparator, parentRight := splitWithoutParent(parent)
+	leaf := tree.findAtLevel(parentSeparator, 0)
+	separator, right := splitWithoutParent(leaf)
+
+	// readers and writers find the keys moved to the right
+	for i := 0; i < 200; i++ {
+		if value, ok := tree.Get(2 * i); !ok || value != 2*i {
+			t.Fatalf("expected %d for %d, but got %d, %v", 2*i, 2*i, value, ok)
+		}
+	}
+	if size := len(collectBLinkKeys(tree)); size != 200 {
+		t.Fatalf("expected 200 keys, but got %d", size)
+	}
+	tree.Put(separator+1, separator+1)
+	tree.Delete(separator + 1)
+	tree.Delete(separator)
+	tree.Put(separator, separator)
+
+	// the split of the leaf completes before the split of its parent
+	leaf.latch.Lock()
+	tree.putIntoParent(nil, leaf, separator, right)
+	parent.latch.Lock()
+	tree.putIntoParent(nil, parent, parentSeparator, parentRight)
+
+	assertBLinkInvariants(t, tree)
+	for i := 0; i < 200; i++ {
+		tree.Delete(2 * i)
+	}
+	if keys := collectBLinkKeys(tree); len(keys) != 0 {
+		t.Fatalf("unexpected keys %v", keys)
+	}
+}
+
+// splitWithoutParent splits the node into two halves and links them,
+// but does not put the separator into the parent.
+func splitWithoutParent[V any](n *blinkNode[int, V]) (int, *blinkNode[int, V]) {
+	s := n.state.Load()
+	middle := len(s.keys) / 2
+
+	left := &blinkState[int, V]{high: s.keys[middle], bounded: true}
+	right := &blinkState[int, V]{high: s.high, bounded: s.bounded, right: s.right}
+	if n.level == 0 {
+		left.keys, left.values = s.keys[:middle], s.values[:middle]
+		right.keys, right.values = s.keys[middle:], s.values[middle:]
+	} else {
+		left.keys, left.children = s.keys[:middle], s.children[:middle+1]
+		right.keys, right.children = s.keys[middle+1:], s.children[middle+1:]
+	}
+
+	rightNode := newBLinkNode(n.level, right)
+	left.right = rightNode
+	n.state.Store(left)
+
+	return left.high, rightNode
+}
+
+func TestBLinkReadersDoNotBlock(t *testing.T) {
+	tree, _ := NewBLinkTree[int, int](Order(3))
+	for i := 0; i < 100; i++ {
+		tree.Put(i, i)
+	}
+
+	// the writer holds the latch of the leaf
+	leaf, _ := tree.findLeaf(50)
+	leaf.latch.Lock()
+	defer leaf.latch.Unlock()
+
+	done := make(chan bool)
+	go func() {
+		tree.Get(50)
+		collectBLinkKeys(tree)
+		done <- true
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the readers are blocked by the writer")
+	}
+}
+
+// TestBLinkStress runs writers that own disjoint sets of keys and readers
+// that iterate over the tree and get the keys. The keys that are never touched
+// by the writers must always be seen by the readers. Run it with the race detector.
+func TestBLinkStress(t *testing.T) {
+	const writers = 8
+	const readers = 4
+	const keyNum = 2000
+	const operations = 3000
+
+	for _, order := range []int{3, 4, 8} {
+		tree, _ := NewBLink(Order(order))
+
+		// the keys k with k % (writers+1) == writers are stable
+		stable := make([][]byte, 0)
+		for k := writers; k < keyNum; k += writers + 1 {
+			stable = append(stable, rankKey(k))
+			tree.Put(rankKey(k), rankKey(k))
+		}
+
+		var wg sync.WaitGroup
+		errs := make(chan error, writers+readers)
+
+		for w := 0; w < writers; w++ {
+			wg.Add(1)
+			go func(w int) {
+				defer wg.Done()
+
+				r := rand.New(rand.NewSource(int64(w)))
+				own := make(map[int]bool)
+				for i := 0; i < operations; i++ {
+					k := r.Intn(keyNum/(writers+1))*(writers+1) + w
+					if r.Intn(3) > 0 {
+						_, ok := tree.Put(rankKey(k), rankKey(k))
+						if ok != own[k] {
+							errs <- fmt.Errorf("writer %d: put of %d returned %v", w, k, ok)
+							return
+						}
+						own[k] = true
+					} else {
+						_, ok := tree.Delete(rankKey(k))
+						if ok != own[k] {
+							errs <- fmt.Errorf("writer %d: delete of %d returned %v", w, k, ok)
+							return
+						}
+						delete(own, k)
+					}
+				}
+			}(w)
+		}
+
+		for reader := 0; reader < readers; reader++ {
+			wg.Add(1)
+			go func(reader int) {
+				defer wg.Done()
+
+				for round := 0; round < 20; round++ {
+					for _, key := range stable {
+						if _, ok := tree.Get(key); !ok {
+							errs <- fmt.Errorf("reader %d: the stable key %v is not found", reader, key)
+							return
+						}
+					}
+
+					var previous []byte
+					i := 0
+					for it := tree.Iterator(); it.HasNext(); {
+						key, _ := it.Next()
+						if previous != nil && bytes.Compare(previous, key) >= 0 {
+							errs <- fmt.Errorf("reader %d: %v goes after %v", reader, key, previous)
+							return
+						}
+						previous = key
+
+						if i < len(stable) && bytes.Equal(key, stable[i]) {
+							i++
+						}
+					}
+
+					if i != len(stable) {
+						errs <- fmt.Errorf("reader %d: missed the stable key %v", reader, stable[i])
+						return
+					}
+				}
+			}(reader)
+		}
+
+		wg.Wait()
+		close(errs)
+		for err := range errs {
+			t.Fatalf("order %d: %v", order, err)
+		}
+
+		assertBLinkInvariants(t, tree.BLinkTree)
+	}
+}
+
+// collectBLinkKeys returns all keys of the tree in the iteration order.
+func collectBLinkKeys[V any](tree *BLinkTree[int, V]) []int {
+	keys := make([]int, 0)
+	for it := tree.Iterator(); it.HasNext(); {
+		key, _ := it.Next()
+		keys = append(keys, key)
+	}
+
+	return keys
+}
+
+// assertBLinkInvariants checks the properties of the B-link tree that is not
+// modified concurrently: sorted keys, high keys, right links, separator keys
+// that match the high keys of the children, leaf depth and size.
+func assertBLinkInvariants[K, V any](t *testing.T, tree *BLinkTree[K, V]) {
+	t.Helper()
+
+	size := 0
+	for first := tree.root.Load(); first != nil; {
+		var next *blinkNode[K, V]
+		var previous *blinkState[K, V]
+		for n := first; n != nil; {
+			s := n.state.Load()
+			if n.level != first.level {
+				t.Fatalf("the node at the level %d is linked at the level %d", n.level, first.level)
+			}
+
+			for i := range s.keys {
+				if i > 0 && !(tree.compare(s.keys[i-1], s.keys[i]) < 0) {
+					t.Fatalf("the keys %v and %v are not sorted", s.keys[i-1], s.keys[i])
+				}
+				if s.bounded && tree.compare(s.keys[i], s.high) >= 0 {
+					t.Fatalf("the key %v is not less than the high key %v", s.keys[i], s.high)
+				}
+				if previous != nil && tree.compare(s.keys[i], previous.high) < 0 {
+					t.Fatalf("the key %v is less than the high key of the left sibling %v", s.keys[i], previous.high)
+				}
+			}
+			if s.bounded != (s.right != nil) {
+				t.Fatal("only the rightmost node is not bounded")
+			}
+
+			if n.level == 0 {
+				size += len(s.keys)
+			} else {
+				if len(s.children) != len(s.keys)+1 {
+					t.Fatalf("the node has %d keys and %d children", len(s.keys), len(s.children))
+				}
+				for i, child := range s.children {
+					c := child.state.Load()
+					if child.level != n.level-1 {
+						t.Fatalf("the child at the level %d is under the level %d", child.level, n.level)
+					}
+					if i < len(s.keys) && (!c.bounded || tree.compare(c.high, s.keys[i]) != 0) {
+						t.Fatalf("the high key of the child %v does not match the separator %v", c.high, s.keys[i])
+					}
+					if i == len(s.keys) && (c.bounded != s.bounded || s.bounded && tree.compare(c.high, s.high) != 0) {
+						t.Fatal("the high key of the last child does not match the high key of the node")
+					}
+					if i > 0 && s.children[i-1].state.Load().right != child {
+						t.Fatal("the children are not linked")
+					}
+				}
+
+				if next == nil {
+					next = s.children[0]
+				}
+			}
+
+			previous = s
+			n = s.right
+		}
+
+		first = next
+	}
+
+	if size != tree.Size() {
+		t.Fatalf("the tree has %d keys, but its size is %d", size, tree.Size())
+	}
+}
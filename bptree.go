@@ -3,6 +3,8 @@ package bptree
 import (
 	"bytes"
 	"fmt"
+	"sync"
+	"time"
 )
 
 const (
@@ -10,29 +12,121 @@ const (
 )
 
 // Option option configuration for B+ tree.
-type Option func(*BPTree) error
+type Option func(*options) error
+
+// options holds the configuration of the B+ tree.
+type options struct {
+	order   int
+	counted bool
+
+	// true if the order and the page size are set by the Order
+	// and PageSize options, not by default
+	orderSet    bool
+	pageSizeSet bool
+
+	// true if the leaves store the common prefix of their keys once
+	prefixCompression bool
+
+	// true if the nodes are allocated from the slabs and reused
+	slabAllocator bool
+
+	// the comparator of the keys, func(x, y K) int for the tree with K keys
+	compare interface{}
+
+	// the size of the pages, the number of the nodes and the number of bytes
+	// kept in memory by the tree that stores its nodes in a file,
+	// zero for no limit
+	pageSize    int
+	cacheSize   int
+	memoryLimit int
+
+	// when the logged tree flushes its log to the disk
+	syncMode     SyncMode
+	syncInterval time.Duration
+}
 
 // Order sets the B+ tree order. The minimum order is 2.
-func Order(order int) func(*BPTree) error {
-	return func(t *BPTree) error {
+func Order(order int) Option {
+	return func(o *options) error {
 		if order < 3 {
 			return fmt.Errorf("order must be >= 3")
 		}
 
-		t.order = order
+		o.order, o.orderSet = order, true
 
 		return nil
 	}
 }
 
-// BPTree is an in-memory implementation of the B+ tree data structure.
-// The tree is not goroutine-safe and access to it must be synchronized.
+// Counted enables the counted mode, in which internal nodes keep
+// the number of keys in their subtrees, so Rank, At and CountRange
+// take O(log n) time instead of O(n).
+func Counted() Option {
+	return func(o *options) error {
+		o.counted = true
+
+		return nil
+	}
+}
+
+// Comparator sets the function that defines the order of keys in the tree.
+// It must return a negative number if x < y, zero if x == y and a positive
+// number if x > y. By default, keys are compared with bytes.Compare for BPTree
+// and with cmp.Compare for Tree.
+func Comparator[K any](compare func(x, y K) int) Option {
+	return func(o *options) error {
+		if compare == nil {
+			return fmt.Errorf("comparator must not be nil")
+		}
+
+		o.compare = compare
+
+		return nil
+	}
+}
+
+// BPTree is an in-memory implementation of the B+ tree data structure
+// with byte-slice keys and values, or a file-backed one returned by Open.
+// The tree is not goroutine-safe and access to it must be synchronized,
+// or use ConcurrentBPTree instead.
 type BPTree struct {
-	root *node
+	*Tree[[]byte, []byte]
+}
 
-	// The pointer to the most leftmost leaf node
-	// to simplify iteration over the leaf nodes.
-	leftmost *node
+// New returns a new instance of the B+ tree. With the MemoryLimit
+// or CacheSize options, it spills the cold nodes to a scratch file.
+func New(options ...Option) (*BPTree, error) {
+	o, err := newOptions(options)
+	if err != nil {
+		return nil, err
+	}
+
+	return newBPTree(o)
+}
+
+// newBPTree returns a new instance of the B+ tree
+// configured by the applied options.
+func newBPTree(o *options) (*BPTree, error) {
+	t, err := newBytesTree(o)
+	if err != nil {
+		return nil, err
+	}
+
+	if o.memoryLimit > 0 || o.cacheSize > 0 {
+		err := spill(t, o)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &BPTree{t}, nil
+}
+
+// Tree is an in-memory implementation of the B+ tree data structure
+// with keys of type K and values of type V.
+// The tree is not goroutine-safe and access to it must be synchronized.
+type Tree[K, V any] struct {
+	root *node[K, V]
 
 	// The order or branching factor of a B+ tree measures the capacity of nodes
 	// for internal nodes in the tree.
@@ -43,142 +137,482 @@ type BPTree struct {
 
 	// minimum allowed number of keys in the tree ceil(order/2)-1
 	minKeyNum int
-}
 
-// New returns a new instance of the B+ tree.
-func New(options ...Option) (*BPTree, error) {
-	t := &BPTree{order: defaultOrder}
+	// true if internal nodes keep the number of keys in their subtrees
+	counted bool
+
+	// true if the leaves store the common prefix of their keys once,
+	// only for the tree with byte-slice keys
+	prefixCompression bool
+
+	// true if the nodes are latched by the concurrent tree
+	latched bool
+
+	// compares the keys and defines their order in the tree
+	compare func(x, y K) int
+
+	// copies the key before it is stored in the tree,
+	// nil if the keys are stored as they are
+	copyKey func(key K) K
 
-	for _, option := range options {
-		err := option(t)
+	// true if the keys are byte slices in the bytes.Compare order
+	bytewise bool
+
+	// returns the shortest key that is greater than x and less than or equal
+	// to y to separate the nodes in their parent, nil if the first key
+	// of the right node separates them
+	separator func(x, y K) K
+
+	// allocates the nodes from the slabs and reuses the removed ones,
+	// nil if every node is allocated on its own
+	allocator *allocator[K, V]
+
+	// the path of the current operation that changes the tree
+	path path[K, V]
+
+	// the generation of the nodes that belong only to the tree,
+	// changed by every snapshot and every new version of the tree
+	generation uint64
+
+	// keeps the nodes in the pages of the file,
+	// nil if the tree is in memory only
+	store *pageStore[K, V]
+
+	// logs the changes before they are applied,
+	// nil if the tree is not logged
+	log *writeAheadLog[K, V]
+}
+
+// newOptions applies the options to the default configuration.
+func newOptions(opts []Option) (*options, error) {
+	o := &options{order: defaultOrder, pageSize: defaultPageSize, syncInterval: defaultSyncInterval}
+	for _, option := range opts {
+		err := option(o)
 		if err != nil {
 			return nil, err
 		}
 	}
 
+	return o, nil
+}
+
+// newTree returns a new instance of the B+ tree with the given comparator,
+// unless the options set another one.
+func newTree[K, V any](compare func(x, y K) int, opts []Option) (*Tree[K, V], error) {
+	o, err := newInMemoryOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return newTreeWithOptions[K, V](compare, o)
+}
+
+// newInMemoryOptions applies the options of the tree that keeps
+// all its nodes in memory to the default configuration.
+func newInMemoryOptions(opts []Option) (*options, error) {
+	o, err := newOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if o.memoryLimit > 0 || o.cacheSize > 0 {
+		return nil, fmt.Errorf("memory limit and cache size are supported only by New and Open")
+	}
+
+	return o, nil
+}
+
+// newBytesTree returns a new instance of the B+ tree with byte-slice keys
+// and values configured by the applied options.
+func newBytesTree(o *options) (*Tree[[]byte, []byte], error) {
+	t, err := newTreeWithOptions[[]byte, []byte](bytes.Compare, o)
+	if err != nil {
+		return nil, err
+	}
+
+	// to guarantee that the B+ tree properties are not violated
+	t.copyKey = copyBytes
+	if t.allocator != nil {
+		t.allocator.arena = &arena{}
+	}
+
+	return t, nil
+}
+
+// newTreeWithOptions returns a new instance of the B+ tree configured
+// by the applied options.
+func newTreeWithOptions[K, V any](compare func(x, y K) int, o *options) (*Tree[K, V], error) {
+	if o.compare != nil {
+		c, ok := o.compare.(func(x, y K) int)
+		if !ok {
+			return nil, fmt.Errorf("comparator does not match the key type")
+		}
+
+		compare = c
+	}
+
+	// the default comparator of the byte-slice keys is bytes.Compare,
+	// so the keys can be shortened and compared by their prefixes
+	_, bytewise := any(compare).(func(x, y []byte) int)
+	bytewise = bytewise && o.compare == nil
+	if o.prefixCompression && !bytewise {
+		return nil, fmt.Errorf("prefix compression is supported only by byte-slice keys in the bytes.Compare order")
+	}
+
+	t := &Tree[K, V]{order: o.order, counted: o.counted, prefixCompression: o.prefixCompression, compare: compare, bytewise: bytewise}
 	t.minKeyNum = ceil(t.order, 2) - 1
+	if bytewise {
+		t.separator = any(shortestSeparator).(func(x, y K) K)
+	}
+	if o.slabAllocator {
+		t.allocator = newAllocator[K, V](t.order)
+	}
 
 	return t, nil
 }
 
+// Get returns a value by the key. The second return
+// value is a flag that determines if the key was found.
+func (t *Tree[K, V]) Get(key K) (V, bool) {
+	var zero V
+	if t.root == nil {
+		return zero, false
+	}
+
+	leaf := t.findLeaf(key)
+	position := leaf.keyPosition(key, t.compare)
+	if position == -1 {
+		return zero, false
+	}
+
+	if t.copiesOut() {
+		return cloneBytes(leaf.values[position]), true
+	}
+
+	return leaf.values[position], true
+}
+
 // Get returns a value by the key. The second return
 // value is a flag that determines if the key was found.
 func (t *BPTree) Get(key []byte) ([]byte, bool) {
+	if !t.bytewise {
+		// the comparator might keep the key, so it gets a copy,
+		// and the key of the caller does not escape to the heap
+		return t.Tree.Get(bytes.Clone(key))
+	}
+
 	if t.root == nil {
 		return nil, false
 	}
 
-	leaf := t.findLeaf(key)
-	for i := 0; i < leaf.keyNum; i++ {
-		if compare(key, leaf.keys[i]) == 0 {
-			return leaf.pointers[i].asValue(), true
+	// bytes.Compare is called directly, since the key passed
+	// to the comparator of the tree escapes to the heap
+	current := t.top()
+	for !current.leaf {
+		position, found := searchBytes(current.keys[:current.keyNum], key)
+		if found {
+			// the keys equal to the separator are in the right subtree
+			position++
 		}
+
+		current = current.child(position)
+	}
+
+	position, found := locateBytes(current, key)
+	if !found {
+		return nil, false
+	}
+
+	if t.copiesOut() {
+		return bytes.Clone(current.values[position]), true
 	}
 
-	return nil, false
+	return current.values[position], true
+}
+
+// Floor returns the greatest key less than or equal to the given key
+// and its value. The last return value is false if there is no such key.
+func (t *Tree[K, V]) Floor(key K) (K, V, bool) {
+	return t.seekReverse(key, true).entry()
+}
+
+// Ceiling returns the least key greater than or equal to the given key
+// and its value. The last return value is false if there is no such key.
+func (t *Tree[K, V]) Ceiling(key K) (K, V, bool) {
+	return t.seek(key, true).entry()
+}
+
+// Lower returns the greatest key strictly less than the given key
+// and its value. The last return value is false if there is no such key.
+func (t *Tree[K, V]) Lower(key K) (K, V, bool) {
+	return t.seekReverse(key, false).entry()
+}
+
+// Higher returns the least key strictly greater than the given key
+// and its value. The last return value is false if there is no such key.
+func (t *Tree[K, V]) Higher(key K) (K, V, bool) {
+	return t.seek(key, false).entry()
+}
+
+// Min returns the least key and its value. The last return value
+// is false if the tree is empty.
+func (t *Tree[K, V]) Min() (K, V, bool) {
+	return t.first().entry()
+}
+
+// Max returns the greatest key and its value. The last return value
+// is false if the tree is empty.
+func (t *Tree[K, V]) Max() (K, V, bool) {
+	return t.last().entry()
+}
+
+// PopMin deletes the least key from the tree and returns it with its value.
+// The last return value is false if the tree is empty or refuses the change.
+func (t *Tree[K, V]) PopMin() (K, V, bool) {
+	key, value, ok := t.Min()
+	if !ok {
+		return key, value, false
+	}
+
+	// the deleted value is returned, so its bytes are not reused
+	if value, ok = t.Delete(key); !ok {
+		// the tree refuses the changes after its log or its pages failed
+		var zeroKey K
+		var zeroValue V
+
+		return zeroKey, zeroValue, false
+	}
+
+	return key, value, true
+}
+
+// PopMax deletes the greatest key from the tree and returns it with its value.
+// The last return value is false if the tree is empty or refuses the change.
+func (t *Tree[K, V]) PopMax() (K, V, bool) {
+	key, value, ok := t.Max()
+	if !ok {
+		return key, value, false
+	}
+
+	// the deleted value is returned, so its bytes are not reused
+	if value, ok = t.Delete(key); !ok {
+		// the tree refuses the changes after its log or its pages failed
+		var zeroKey K
+		var zeroValue V
+
+		return zeroKey, zeroValue, false
+	}
+
+	return key, value, true
+}
+
+// entryAt returns the key and the value at the position of the leaf node.
+func entryAt[K, V any](leaf *node[K, V], position int) (K, V, bool) {
+	if leaf == nil {
+		var key K
+		var value V
+
+		return key, value, false
+	}
+
+	return leaf.key(position), leaf.values[position], true
 }
 
 // findLeaf finds a leaf that might contain the key.
-func (t *BPTree) findLeaf(key []byte) *node {
-	current := t.root
+func (t *Tree[K, V]) findLeaf(key K) *node[K, V] {
+	current := t.top()
 	for !current.leaf {
-		position := 0
-		for position < current.keyNum {
-			if less(key, current.keys[position]) {
-				break
-			} else {
-				position += 1
-			}
+		current = current.child(current.childPosition(key, t.compare))
+	}
+
+	return current
+}
+
+// findPath finds a leaf that might contain the key and
+// the path from the root to it.
+// The path is reused by the next operation, since the tree
+// is changed by one operation at a time.
+func (t *Tree[K, V]) findPath(key K) (*path[K, V], *node[K, V]) {
+	p := &t.path
+	p.reset()
+
+	current := t.top()
+	for !current.leaf {
+		position := current.childPosition(key, t.compare)
+		p.push(current, position)
+
+		current = current.child(position)
+	}
+
+	return p, current
+}
+
+// first returns the cursor at the least key of the tree.
+func (t *Tree[K, V]) first() *cursor[K, V] {
+	c := &cursor[K, V]{copyOut: t.copiesOut()}
+	if t.root != nil {
+		c.descendFirst(t.top())
+		if c.leaf().keyNum == 0 {
+			// the leaf that cannot be read is empty
+			c.nextLeaf()
+		}
+	}
+
+	return c
+}
+
+// last returns the cursor at the greatest key of the tree.
+func (t *Tree[K, V]) last() *cursor[K, V] {
+	c := &cursor[K, V]{copyOut: t.copiesOut()}
+	if t.root != nil {
+		c.descendLast(t.top())
+		if c.leaf().keyNum == 0 {
+			// the leaf that cannot be read is empty
+			c.previousLeaf()
 		}
+	}
 
-		current = current.pointers[position].asNode()
+	return c
+}
+
+// seek returns the cursor at the first key that is greater than
+// the given key, or equal to it if inclusive is true.
+func (t *Tree[K, V]) seek(key K, inclusive bool) *cursor[K, V] {
+	c := &cursor[K, V]{copyOut: t.copiesOut()}
+	if t.root == nil {
+		return c
 	}
 
-	return current
+	c.descend(t.top(), key, t.compare)
+	leaf := c.leaf()
+
+	position, found := leaf.locate(key, t.compare)
+	if found && !inclusive {
+		position++
+	}
+
+	c.positions[len(c.positions)-1] = position
+	if position == leaf.keyNum {
+		// all keys in the leaf are less than the given key,
+		// so the first key of the next leaf is the one
+		c.nextLeaf()
+	}
+
+	return c
+}
+
+// seekReverse returns the cursor at the last key that is less than
+// the given key, or equal to it if inclusive is true.
+func (t *Tree[K, V]) seekReverse(key K, inclusive bool) *cursor[K, V] {
+	c := &cursor[K, V]{copyOut: t.copiesOut()}
+	if t.root == nil {
+		return c
+	}
+
+	c.descend(t.top(), key, t.compare)
+	leaf := c.leaf()
+
+	position, found := leaf.locate(key, t.compare)
+	if !found || !inclusive {
+		position--
+	}
+
+	c.positions[len(c.positions)-1] = position
+	if position == -1 {
+		// all keys in the leaf are greater than the given key,
+		// so the last key of the previous leaf is the one
+		c.previousLeaf()
+	}
+
+	return c
 }
 
 // Put inserts the value into the tree. If the key already exists,
 // it overrides it.
 // Returns true and the previous value if the value has been overridden,
 // otherwise false.
-func (t *BPTree) Put(key, value []byte) ([]byte, bool) {
+// The logged tree refuses the change after writing its log failed, and
+// the tree that stores its nodes in a file after reading its pages failed:
+// Put returns false without inserting the value, and Err returns the error.
+func (t *Tree[K, V]) Put(key K, value V) (V, bool) {
+	if t.storeErr() != nil || t.log != nil && t.log.write(t.log.appendPut(nil, key, value)) != nil {
+		var zero V
+		return zero, false
+	}
+
 	if t.root == nil {
 		t.initializeRoot(key, value)
 
-		return nil, false
+		var zero V
+		return zero, false
 	}
 
-	leaf := t.findLeaf(key)
+	p, leaf := t.findPath(key)
+	if t.storeErr() != nil {
+		// the leaf for the key cannot be read
+		var zero V
+		return zero, false
+	}
+
+	oldValue, overridden := t.putIntoLeaf(p, leaf, key, value)
+	if !overridden {
+		t.size++
+	}
 
-	return t.putIntoLeaf(leaf, key, value)
+	return oldValue, overridden
 }
 
 // initializeRoot initializes root in the empty tree.
-func (t *BPTree) initializeRoot(key, value []byte) {
+func (t *Tree[K, V]) initializeRoot(key K, value V) {
 	// new tree
-	keys := make([][]byte, t.order-1)
-	keys[0] = copyBytes(key)
+	t.root = t.newNode(true)
+	t.root.appendValue(t.storedKey(key), t.storedValue(value))
+
+	t.size++
+}
+
+// putIntoLeaf puts key and value into the node. The path leads
+// from the root to the node, and it is split along it if necessary.
+func (t *Tree[K, V]) putIntoLeaf(p *path[K, V], n *node[K, V], k K, v V) (V, bool) {
+	n = t.ownPath(p, n)
+	v = t.storedValue(v)
 
-	pointers := make([]*pointer, t.order)
-	pointers[0] = &pointer{value}
+	insertPos, found := n.locate(k, t.compare)
+	if found {
+		// found the exact match
+		oldValue := n.values[insertPos]
+		n.values[insertPos] = v
 
-	t.root = &node{
-		leaf:     true,
-		parent:   nil,
-		keys:     keys,
-		keyNum:   1,
-		pointers: pointers,
+		return oldValue, true
 	}
 
-	t.leftmost = t.root
-	t.size++
-}
+	// if we did not find the same key, we continue to insert,
+	// but the compressed leaf copies only the suffix of the key
+	if len(n.prefix()) == 0 {
+		k = t.storedKey(k)
+	}
 
-// putIntoLeaf puts key and value into the node.
-func (t *BPTree) putIntoLeaf(n *node, k, v []byte) ([]byte, bool) {
-	insertPos := 0
-	for insertPos < n.keyNum {
-		cmp := compare(k, n.keys[insertPos])
-		if cmp == 0 {
-			// found the exact match
-			oldValue := n.pointers[insertPos].overrideValue(v)
-
-			return oldValue, true
-		} else if cmp < 0 {
-			// found the insert position,
-			// can break the loop
-			break
+	if t.counted {
+		for _, parent := range p.nodes {
+			parent.state.count++
 		}
-
-		insertPos++
 	}
 
-	// if we did not find the same key, we continue to insert
 	if n.keyNum < len(n.keys) {
 		// if the node is not full
 
-		// shift the keys and pointers
-		for j := n.keyNum; j > insertPos; j-- {
-			n.keys[j] = n.keys[j-1]
-			n.pointers[j] = n.pointers[j-1]
-		}
-
-		// insert
-		n.keys[insertPos] = k
-		n.pointers[insertPos] = &pointer{v}
-		// and update key num
-		n.keyNum++
+		n.insertValueAt(insertPos, k, v)
 	} else {
 		// if the node is full
-		parent := n.parent
 		left, right := t.putIntoLeafAndSplit(n, insertPos, k, v)
-		insertKey := right.keys[0]
+		insertKey := t.separatorBetween(left, right)
 
-		for left != nil && right != nil {
-			if parent == nil {
+		for level := len(p.nodes) - 1; ; level-- {
+			if level < 0 {
 				t.putIntoNewRoot(insertKey, left, right)
 				break
 			} else {
+				parent := p.nodes[level]
 				if parent.keyNum < len(parent.keys) {
 					// if the parent is not full
 					t.putIntoParent(parent, insertKey, left, right)
@@ -189,91 +623,48 @@ func (t *BPTree) putIntoLeaf(n *node, k, v []byte) ([]byte, bool) {
 					insertKey, left, right = t.putIntoParentAndSplit(parent, insertKey, left, right)
 				}
 			}
-
-			parent = parent.parent
 		}
 	}
 
-	t.size++
-
-	return nil, false
+	var zero V
+	return zero, false
 }
 
 // putIntoParent puts the node into the parent and update the left and the right
-// pointers.
-func (t *BPTree) putIntoParent(parent *node, k []byte, l, r *node) {
-	insertPos := 0
-	for insertPos < parent.keyNum {
-		if less(k, parent.keys[insertPos]) {
-			// found the insert position,
-			// can break the loop
-			break
-		}
+// children.
+func (t *Tree[K, V]) putIntoParent(parent *node[K, V], k K, l, r *node[K, V]) {
+	insertPos := parent.childPosition(k, t.compare)
 
-		insertPos++
-	}
-
-	// shift the keys and pointers
-	parent.pointers[parent.keyNum+1] = parent.pointers[parent.keyNum]
-	for j := parent.keyNum; j > insertPos; j-- {
-		parent.keys[j] = parent.keys[j-1]
-		parent.pointers[j] = parent.pointers[j-1]
-	}
-
-	// insert
-	parent.keys[insertPos] = k
-	parent.pointers[insertPos] = &pointer{l}
-	parent.pointers[insertPos+1] = &pointer{r}
-	// and update key num
-	parent.keyNum++
-
-	l.parent = parent
-	r.parent = parent
+	// the left node is already at the position
+	parent.insertChildAt(insertPos, k, insertPos+1, r)
+	parent.children[insertPos] = l
 }
 
 // putIntoNewRoot creates new root, inserts left and right entries
 // and updates the tree.
-func (t *BPTree) putIntoNewRoot(key []byte, l, r *node) {
+func (t *Tree[K, V]) putIntoNewRoot(key K, l, r *node[K, V]) {
 	// new root
-	newRoot := &node{
-		leaf:     false,
-		keys:     make([][]byte, t.order-1),
-		pointers: make([]*pointer, t.order),
-		parent:   nil,
-		keyNum:   1, // we are going to put just one key
-	}
+	newRoot := t.newNode(false)
+	newRoot.keyNum = 1 // we are going to put just one key
 
 	newRoot.keys[0] = key
-	newRoot.pointers[0] = &pointer{l}
-	newRoot.pointers[1] = &pointer{r}
+	newRoot.children[0] = l
+	newRoot.children[1] = r
 
-	l.parent = newRoot
-	r.parent = newRoot
+	if t.counted {
+		newRoot.recount()
+	}
 
 	t.root = newRoot
 }
 
 // putIntoParentAndSplit puts key in the parent, splits the node and returns the splitten
-// nodes with all fixed pointers.
-func (t *BPTree) putIntoParentAndSplit(parent *node, k []byte, l, r *node) ([]byte, *node, *node) {
-	insertPos := 0
-	for insertPos < parent.keyNum {
-		if less(k, parent.keys[insertPos]) {
-			// found the insert position,
-			// can break the loop
-			break
-		}
+// nodes with all fixed children.
+func (t *Tree[K, V]) putIntoParentAndSplit(parent *node[K, V], k K, l, r *node[K, V]) (K, *node[K, V], *node[K, V]) {
+	// the key goes after the keys that are less than or equal to it
+	insertPos := parent.childPosition(k, t.compare)
 
-		insertPos++
-	}
-
-	right := &node{
-		leaf:     false,
-		keys:     make([][]byte, t.order-1),
-		keyNum:   0,
-		pointers: make([]*pointer, t.order),
-		parent:   nil,
-	}
+	right := t.newNode(false)
 
 	middlePos := ceil(len(parent.keys), 2)
 	copyFrom := middlePos
@@ -283,17 +674,17 @@ func (t *BPTree) putIntoParentAndSplit(parent *node, k []byte, l, r *node) ([]by
 	}
 
 	copy(right.keys, parent.keys[copyFrom:])
-	copy(right.pointers, parent.pointers[copyFrom:])
-	// copy the pointer to the next node
+	copy(right.children, parent.children[copyFrom:])
 	right.keyNum = len(right.keys) - copyFrom
 
 	// the given node becomes the left node
 	left := parent
 	left.keyNum = copyFrom
-	// clean up keys and pointers
+	// clean up keys and children
+	var zeroKey K
 	for i := len(left.keys) - 1; i >= copyFrom; i-- {
-		left.keys[i] = nil
-		left.pointers[i+1] = nil
+		left.keys[i] = zeroKey
+		left.children[i+1] = nil
 	}
 
 	insertNode := left
@@ -302,43 +693,25 @@ func (t *BPTree) putIntoParentAndSplit(parent *node, k []byte, l, r *node) ([]by
 		insertPos -= middlePos
 	}
 
-	// insert into the node
-	insertNode.pointers[insertNode.keyNum+1] = insertNode.pointers[insertNode.keyNum]
-	for j := insertNode.keyNum; j > insertPos; j-- {
-		insertNode.keys[j] = insertNode.keys[j-1]
-		insertNode.pointers[j] = insertNode.pointers[j-1]
-	}
-
-	insertNode.keys[insertPos] = k
-	insertNode.pointers[insertPos] = &pointer{l}
-	insertNode.pointers[insertPos+1] = &pointer{r}
-	insertNode.keyNum++
-
-	l.parent = insertNode
-	r.parent = insertNode
+	// insert into the node, the left node is already at the position
+	insertNode.insertChildAt(insertPos, k, insertPos+1, r)
+	insertNode.children[insertPos] = l
 
 	middleKey := right.keys[0]
 
 	// clean up the right node
 	for i := 1; i < right.keyNum; i++ {
 		right.keys[i-1] = right.keys[i]
-		right.pointers[i-1] = right.pointers[i]
+		right.children[i-1] = right.children[i]
 	}
-	right.pointers[right.keyNum-1] = right.pointers[right.keyNum]
-	right.pointers[right.keyNum] = nil
-	right.keys[right.keyNum-1] = nil
+	right.children[right.keyNum-1] = right.children[right.keyNum]
+	right.children[right.keyNum] = nil
+	right.keys[right.keyNum-1] = zeroKey
 	right.keyNum--
 
-	// update the pointers
-	for _, p := range left.pointers {
-		if p != nil {
-			p.asNode().parent = left
-		}
-	}
-	for _, p := range right.pointers {
-		if p != nil {
-			p.asNode().parent = right
-		}
+	if t.counted {
+		left.recount()
+		right.recount()
 	}
 
 	return middleKey, left, right
@@ -349,13 +722,11 @@ func (t *BPTree) putIntoParentAndSplit(parent *node, k []byte, l, r *node) ([]by
 // The given node becomes left node.
 // The tree is right-biased, so the first element in
 // the right node is the "middle" key.
-func (t *BPTree) putIntoLeafAndSplit(n *node, insertPos int, k, v []byte) (*node, *node) {
-	right := &node{
-		leaf:     true,
-		keys:     make([][]byte, t.order-1),
-		keyNum:   0,
-		pointers: make([]*pointer, t.order),
-		parent:   nil,
+func (t *Tree[K, V]) putIntoLeafAndSplit(n *node[K, V], insertPos int, k K, v V) (*node[K, V], *node[K, V]) {
+	right := t.newNode(true)
+	if n.frame != nil {
+		// the right node goes between the node and its next leaf
+		right.frame.next, n.frame.next = n.frame.next, right.frame.page
 	}
 
 	middlePos := ceil(len(n.keys), 2)
@@ -366,22 +737,22 @@ func (t *BPTree) putIntoLeafAndSplit(n *node, insertPos int, k, v []byte) (*node
 	}
 
 	copy(right.keys, n.keys[copyFrom:])
-	copy(right.pointers, n.pointers[copyFrom:len(n.pointers)-1])
-
-	// copy the pointer to the next node
-	right.setNext(n.next())
+	copy(right.values, n.values[copyFrom:])
 	right.keyNum = len(right.keys) - copyFrom
+	if len(n.prefix()) > 0 {
+		right.state.prefix = n.state.prefix
+	}
 
 	// the given node becomes the left node
 	left := n
-	left.parent = nil
 	left.keyNum = copyFrom
-	// clean up keys and pointers
+	// clean up keys and values
+	var zeroKey K
+	var zeroValue V
 	for i := len(left.keys) - 1; i >= copyFrom; i-- {
-		left.keys[i] = nil
-		left.pointers[i] = nil
+		left.keys[i] = zeroKey
+		left.values[i] = zeroValue
 	}
-	left.setNext(&pointer{right})
 
 	insertNode := left
 	if insertPos >= middlePos {
@@ -391,23 +762,41 @@ func (t *BPTree) putIntoLeafAndSplit(n *node, insertPos int, k, v []byte) (*node
 	}
 
 	// insert into the node
-	insertNode.insertAt(insertPos, k, insertPos, &pointer{v})
+	insertNode.insertValueAt(insertPos, k, v)
+
+	// the halves might share longer prefixes than the node
+	t.compress(left)
+	t.compress(right)
 
 	return left, right
 }
 
 // Delete deletes the key from the tree. Returns deleted value and true
 // if the key exists, otherwise nil and false.
-func (t *BPTree) Delete(key []byte) ([]byte, bool) {
+// The logged tree refuses the change after writing its log failed, and
+// the tree that stores its nodes in a file after reading its pages failed:
+// Delete returns false without deleting the key, and Err returns the error.
+func (t *Tree[K, V]) Delete(key K) (V, bool) {
 	if t.root == nil {
-		return nil, false
+		var zero V
+		return zero, false
 	}
 
-	leaf := t.findLeaf(key)
+	p, leaf := t.findPath(key)
+
+	// the missing key is not logged, since there is nothing to delete
+	if t.storeErr() != nil || t.log != nil && (leaf.keyPosition(key, t.compare) == -1 || t.log.write(t.log.appendDelete(nil, key)) != nil) {
+		var zero V
+		return zero, false
+	}
 
-	value, deleted := t.deleteAtLeafAndRebalance(leaf, key)
+	value, deleted := t.deleteAtLeafAndRebalance(p, leaf, key)
 	if !deleted {
-		return nil, false
+		return value, false
+	}
+
+	if t.root != nil {
+		t.removeFromIndex(key)
 	}
 
 	t.size--
@@ -415,20 +804,32 @@ func (t *BPTree) Delete(key []byte) ([]byte, bool) {
 	return value, true
 }
 
-// deleteAtLeafAndRebalance deletes the key from the given node and rebalances it.
-func (t *BPTree) deleteAtLeafAndRebalance(n *node, key []byte) ([]byte, bool) {
-	keyPos := n.keyPosition(key)
+// deleteAtLeafAndRebalance deletes the key from the given node and rebalances
+// the nodes on the path from the root to it.
+func (t *Tree[K, V]) deleteAtLeafAndRebalance(p *path[K, V], n *node[K, V], key K) (V, bool) {
+	keyPos := n.keyPosition(key, t.compare)
 	if keyPos == -1 {
-		return nil, false
+		var zero V
+		return zero, false
 	}
 
-	value := n.pointers[keyPos].asValue()
+	n = t.ownPath(p, n)
+	// the value is returned, so only the bytes of the key are reused
+	value := n.values[keyPos]
+	t.freeKey(n.keys[keyPos])
 	n.deleteAt(keyPos, keyPos)
 
-	if n.parent == nil {
-		// deletion from the root 				
+	if t.counted {
+		for _, parent := range p.nodes {
+			parent.state.count--
+		}
+	}
+
+	if len(p.nodes) == 0 {
+		// deletion from the root
 		if n.keyNum == 0 {
-			// remove the root 
+			// remove the root
+			t.drop(n)
 			t.root = nil
 		}
 
@@ -436,56 +837,78 @@ func (t *BPTree) deleteAtLeafAndRebalance(n *node, key []byte) ([]byte, bool) {
 	}
 
 	if n.keyNum < t.minKeyNum {
-		t.rebalanceFromLeafNode(n)
+		t.rebalanceFromLeafNode(p, n)
 	}
 
-	t.removeFromIndex(key)
-
 	return value, true
 }
 
 // removeFromIndex searches the key in the index (internal nodes and if finds it changes to
 // the leftmost key in the right subtree.
-func (t *BPTree) removeFromIndex(key []byte) {
-	current := t.root
+func (t *Tree[K, V]) removeFromIndex(key K) {
+	var parent *node[K, V]
+	parentPosition := 0
+
+	current := t.top()
 	for !current.leaf {
 		// until the leaf is reached
 
-		position := 0
-		for position < current.keyNum {
-			cmp := compare(key, current.keys[position])
-			if cmp < 0 {
-				break
-			} else if cmp > 0 {
-				position += 1
-			} else if cmp == 0 {
-				// the key is found in the index
-				// take the right sub-tree and find the leftmost key
-				// and update the key
-				current.keys[position] = findLeftmostKey(current.pointers[position+1].asNode())
-			}
+		position, found := search(current.keys[:current.keyNum], key, t.compare)
+		if found {
+			// the key is found in the index
+			// take the right sub-tree and find the leftmost key
+			// and update the key
+			current = t.own(parent, parentPosition, current)
+			current.keys[position] = t.indexKey(findLeftmostKey(current.child(position + 1)))
 		}
 
-		current = current.pointers[position].asNode()
+		parent, parentPosition = current, position
+		current = current.child(position)
 	}
 }
 
 // findLeftmostKey returns the leftmost key for the node.
-func findLeftmostKey(n *node) []byte {
+func findLeftmostKey[K, V any](n *node[K, V]) K {
 	current := n
 	for !current.leaf {
-		current = current.pointers[0].asNode()
+		current = current.child(0)
+	}
+
+	return current.key(0)
+}
+
+// separatorBetween returns the key that separates the subtree from its right
+// sibling in their parent. It is the first key of the right subtree, unless
+// the tree promotes the shortest separators.
+func (t *Tree[K, V]) separatorBetween(left, right *node[K, V]) K {
+	first := findLeftmostKey(right)
+	if t.separator == nil {
+		return t.indexKey(first)
 	}
 
-	return current.keys[0]
+	for !left.leaf {
+		left = left.child(left.keyNum)
+	}
+
+	return t.separator(left.key(left.keyNum-1), first)
 }
 
-// rebalanceFromLeafNode starts rebalancing the tree from the leaf node.
-func (t *BPTree) rebalanceFromLeafNode(n *node) {
-	parent := n.parent
+// shortestSeparator returns the shortest prefix of y that is greater than x,
+// where x is less than y in the bytes.Compare order. The separator is copied,
+// so it does not keep the key in memory after it is deleted.
+func shortestSeparator(x, y []byte) []byte {
+	// x either ends with the common prefix or its next byte is less than the one of y
+	return bytes.Clone(y[:commonPrefixLength(x, y)+1])
+}
 
-	pointerPositionInParent := parent.pointerPositionOf(n)
-	keyPositionInParent := pointerPositionInParent - 1
+// rebalanceFromLeafNode starts rebalancing the tree from the leaf node
+// at the end of the path.
+func (t *Tree[K, V]) rebalanceFromLeafNode(p *path[K, V], n *node[K, V]) {
+	level := len(p.nodes) - 1
+	parent := p.nodes[level]
+
+	childPositionInParent := p.positions[level]
+	keyPositionInParent := childPositionInParent - 1
 	if keyPositionInParent < 0 {
 		keyPositionInParent = 0
 	}
@@ -493,72 +916,81 @@ func (t *BPTree) rebalanceFromLeafNode(n *node) {
 	// trying to borrow for the leaf from any sibling
 
 	// check left sibling
-	leftSiblingPosition := pointerPositionInParent - 1
-	var leftSibling *node
+	leftSiblingPosition := childPositionInParent - 1
+	var leftSibling *node[K, V]
 	if leftSiblingPosition >= 0 {
 		// if left sibling exists
-		leftSibling = parent.pointers[leftSiblingPosition].asNode()
+		leftSibling = parent.child(leftSiblingPosition)
 
 		if leftSibling.keyNum > t.minKeyNum {
 			// borrow from the left sibling
-			n.insertAt(0, leftSibling.keys[leftSibling.keyNum-1], 0, leftSibling.pointers[leftSibling.keyNum-1])
+			leftSibling = t.own(parent, leftSiblingPosition, leftSibling)
+			n.insertValueAt(0, leftSibling.key(leftSibling.keyNum-1), leftSibling.values[leftSibling.keyNum-1])
 			leftSibling.deleteAt(leftSibling.keyNum-1, leftSibling.keyNum-1)
-			parent.keys[keyPositionInParent] = n.keys[0]
+			parent.keys[keyPositionInParent] = t.separatorBetween(leftSibling, n)
 			return
 		}
 	}
 
-	rightSiblingPosition := pointerPositionInParent + 1
-	var rightSibling *node
+	rightSiblingPosition := childPositionInParent + 1
+	var rightSibling *node[K, V]
 	if rightSiblingPosition < parent.keyNum+1 {
 		// if right sibling exists
-		rightSibling = parent.pointers[rightSiblingPosition].asNode()
+		rightSibling = parent.child(rightSiblingPosition)
 
 		if rightSibling.keyNum > t.minKeyNum {
 			// borrow from the right sibling
-			n.append(rightSibling.keys[0], rightSibling.pointers[0])
+			rightSibling = t.own(parent, rightSiblingPosition, rightSibling)
+			n.appendValue(rightSibling.key(0), rightSibling.values[0])
 			rightSibling.deleteAt(0, 0)
-			parent.keys[rightSiblingPosition-1] = rightSibling.keys[0]
+			parent.keys[rightSiblingPosition-1] = t.separatorBetween(n, rightSibling)
 			return
 		}
 	}
 
 	// if we could borrow, we would borrow
 	// so, we just take the first available sibling and merge with it
-	// and the remove the navigator key and appropriate pointer
+	// and the remove the navigator key and appropriate child
 
 	// merge nodes and remove the "navigator" key and appropriate
 	if leftSibling != nil {
+		leftSibling = t.own(parent, leftSiblingPosition, leftSibling)
 		leftSibling.copyFromRight(n)
-		parent.deleteAt(keyPositionInParent, pointerPositionInParent)
+		parent.deleteAt(keyPositionInParent, childPositionInParent)
+		t.drop(n)
 	} else if rightSibling != nil {
+		// the values of the merged sibling are overridden in place afterwards
+		rightSibling = t.own(parent, rightSiblingPosition, rightSibling)
 		n.copyFromRight(rightSibling)
 		parent.deleteAt(keyPositionInParent, rightSiblingPosition)
+		t.drop(rightSibling)
 	}
 
-	t.rebalanceParentNode(parent)
+	t.rebalanceParentNode(p, level)
 }
 
-// rebalanceInternalNode rebalances the tree from the internal node. It expects that
-func (t *BPTree) rebalanceParentNode(n *node) {
-	if n.parent == nil {
-		if n.keyNum == 0 {
-			t.root = n.pointers[0].asNode()
-			t.root.parent = nil
-		}
-
+// rebalanceParentNode rebalances the tree from the internal node
+// at the level of the path.
+func (t *Tree[K, V]) rebalanceParentNode(p *path[K, V], level int) {
+	n := p.nodes[level]
+	if n.keyNum >= t.minKeyNum {
+		// balanced
 		return
 	}
 
-	if n.keyNum >= t.minKeyNum {
-		// balanced
+	if level == 0 {
+		if n.keyNum == 0 {
+			t.root = n.child(0)
+			t.drop(n)
+		}
+
 		return
 	}
 
-	parent := n.parent
+	parent := p.nodes[level-1]
 
-	pointerPositionInParent := n.parent.pointerPositionOf(n)
-	keyPositionInParent := pointerPositionInParent - 1
+	childPositionInParent := p.positions[level-1]
+	keyPositionInParent := childPositionInParent - 1
 	if keyPositionInParent < 0 {
 		keyPositionInParent = 0
 	}
@@ -566,41 +998,53 @@ func (t *BPTree) rebalanceParentNode(n *node) {
 	// trying to borrow for the internal node from any sibling
 
 	// check left sibling
-	leftSiblingPosition := pointerPositionInParent - 1
-	var leftSibling *node
+	leftSiblingPosition := childPositionInParent - 1
+	var leftSibling *node[K, V]
 	if leftSiblingPosition >= 0 {
 		// if left sibling exists
-		leftSibling = parent.pointers[leftSiblingPosition].asNode()
+		leftSibling = parent.child(leftSiblingPosition)
 
 		if leftSibling.keyNum > t.minKeyNum {
 			splitKey := parent.keys[keyPositionInParent]
 
 			// borrow from the left sibling
-			leftSibling.pointers[leftSibling.keyNum].asNode().parent = n
-			n.insertAt(0, splitKey, 0, leftSibling.pointers[leftSibling.keyNum])
+			leftSibling = t.own(parent, leftSiblingPosition, leftSibling)
+			n.insertChildAt(0, splitKey, 0, leftSibling.children[leftSibling.keyNum])
 
 			parent.keys[keyPositionInParent] = leftSibling.keys[leftSibling.keyNum-1]
 			leftSibling.deleteAt(leftSibling.keyNum-1, leftSibling.keyNum)
 
+			if t.counted {
+				leftSibling.recount()
+				n.recount()
+			}
+
 			return
 		}
 	}
 
-	rightSiblingPosition := pointerPositionInParent + 1
-	var rightSibling *node
+	rightSiblingPosition := childPositionInParent + 1
+	var rightSibling *node[K, V]
 	if rightSiblingPosition < parent.keyNum+1 {
 		// if right sibling exists
-		rightSibling = parent.pointers[rightSiblingPosition].asNode()
+		rightSibling = parent.child(rightSiblingPosition)
 
 		if rightSibling.keyNum > t.minKeyNum {
 			splitKeyPosition := rightSiblingPosition - 1
 			splitKey := parent.keys[splitKeyPosition]
 
 			// borrow from the right sibling
-			n.append(splitKey, rightSibling.pointers[0])
+			rightSibling = t.own(parent, rightSiblingPosition, rightSibling)
+			n.appendChild(splitKey, rightSibling.children[0])
 
 			parent.keys[splitKeyPosition] = rightSibling.keys[0]
 			rightSibling.deleteAt(0, 0)
+
+			if t.counted {
+				rightSibling.recount()
+				n.recount()
+			}
+
 			return
 		}
 	}
@@ -611,12 +1055,18 @@ func (t *BPTree) rebalanceParentNode(n *node) {
 		splitKey := parent.keys[keyPositionInParent]
 
 		// incorporate the split key from parent for the merging
+		leftSibling = t.own(parent, leftSiblingPosition, leftSibling)
 		leftSibling.keys[leftSibling.keyNum] = splitKey
 		leftSibling.keyNum++
 
 		leftSibling.copyFromRight(n)
 
-		parent.deleteAt(keyPositionInParent, pointerPositionInParent)
+		parent.deleteAt(keyPositionInParent, childPositionInParent)
+		t.drop(n)
+
+		if t.counted {
+			leftSibling.recount()
+		}
 	} else if rightSibling != nil {
 		splitKey := parent.keys[keyPositionInParent]
 
@@ -625,189 +1075,372 @@ func (t *BPTree) rebalanceParentNode(n *node) {
 
 		n.copyFromRight(rightSibling)
 		parent.deleteAt(keyPositionInParent, rightSiblingPosition)
+		t.drop(rightSibling)
+
+		if t.counted {
+			n.recount()
+		}
 	}
 
-	t.rebalanceParentNode(parent)
+	t.rebalanceParentNode(p, level-1)
 }
 
 // ForEach traverses tree in ascending key order.
-func (t *BPTree) ForEach(action func(key []byte, value []byte)) {
+func (t *Tree[K, V]) ForEach(action func(key K, value V)) {
 	for it := t.Iterator(); it.HasNext(); {
 		key, value := it.Next()
 		action(key, value)
 	}
 }
 
+// ScanPrefix traverses the keys with the given prefix in ascending key order.
+func (t *BPTree) ScanPrefix(prefix []byte, action func(key []byte, value []byte)) {
+	for it := t.PrefixIterator(prefix); it.HasNext(); {
+		key, value := it.Next()
+		action(key, value)
+	}
+}
+
+// ForEachReverse traverses tree in descending key order.
+func (t *Tree[K, V]) ForEachReverse(action func(key K, value V)) {
+	for it := t.ReverseIterator(); it.HasNext(); {
+		key, value := it.Next()
+		action(key, value)
+	}
+}
+
 // Size return the size of the tree.
-func (t *BPTree) Size() int {
+func (t *Tree[K, V]) Size() int {
 	return t.size
 }
 
 // node reprents a node in the B+ tree.
-type node struct {
+type node[K, V any] struct {
 	// true for leaf node and root without children
 	// and false for internal node and root with children
-	leaf   bool
-	parent *node
+	leaf bool
 
 	// Real key number is stored under the keyNum.
-	keys   [][]byte
+	keys   []K
 	keyNum int
 
-	// Leaf nodes can point to the value,
-	// but internal nodes point to the nodes. So
-	// to save space, we can use pointers abstraction.
-	// The size of pointers equals to the size of keys + 1.
-	// In the leaf node, the last pointers element points to
-	// the next leaf node.
-	pointers []*pointer
+	// The values of the leaf node at the positions of their keys,
+	// nil for the internal node. The values are stored in place,
+	// so they do not need an allocation each.
+	values []V
+
+	// The children of the internal node, one more than the keys,
+	// nil for the leaf node. The leaf nodes are not linked, since
+	// they might be shared by the versions of the tree.
+	children []*node[K, V]
+
+	// The generation of the tree in which the node was created.
+	// The nodes of other generations might be shared with the snapshots
+	// and the versions of the tree, so they are copied before they are modified.
+	generation uint64
+
+	// The page of the node in the file-backed tree, nil in memory.
+	frame *frame[K, V]
+
+	// The state that only some trees need, nil for the nodes
+	// of the other trees, so they do not carry it.
+	state *nodeState
 }
 
-// copyFromRight copies the keys and the pointer from the given node.
-func (n *node) copyFromRight(from *node) {
-	for i := 0; i < from.keyNum; i++ {
-		n.append(from.keys[i], from.pointers[i])
-	}
+// nodeState is the state of the node kept aside from it: the latch
+// of the node in the concurrent tree, the common prefix of the compressed leaf
+// and the number of keys in the subtree of the internal node in the counted mode.
+type nodeState struct {
+	// Guards the node in the concurrent tree.
+	latch sync.RWMutex
 
-	if n.leaf {
-		n.setNext(from.next())
+	// The common prefix of the keys of the compressed leaf, which keeps
+	// only the suffixes of its keys then, empty otherwise.
+	prefix []byte
+
+	// The number of keys in the subtree. Only relevant for
+	// the internal nodes of the tree in the counted mode.
+	count int
+}
+
+// newNode returns a new empty node of the tree.
+func (t *Tree[K, V]) newNode(leaf bool) *node[K, V] {
+	var n *node[K, V]
+	if t.allocator != nil {
+		n = t.allocator.allocate(leaf)
 	} else {
-		n.pointers[n.keyNum] = from.pointers[from.keyNum]
-		n.pointers[n.keyNum].asNode().parent = n
+		n = &node[K, V]{
+			leaf:   leaf,
+			keys:   make([]K, t.order-1),
+			keyNum: 0,
+		}
+		if leaf {
+			n.values = make([]V, t.order-1)
+		} else {
+			n.children = make([]*node[K, V], t.order)
+		}
+	}
+	n.generation = t.generation
+	t.giveState(n)
+
+	if t.store != nil {
+		t.store.attach(n)
 	}
+
+	return n
 }
 
-//  keyPosition returns the position of the key, but -1 if it is not present.
-func (n *node) keyPosition(key []byte) int {
-	keyPosition := 0
-	for ; keyPosition < n.keyNum; keyPosition++ {
-		if compare(key, n.keys[keyPosition]) == 0 {
-			return keyPosition
-		}
+// giveState gives the node the state kept aside if the tree needs it:
+// every node of the concurrent tree, the internal node of the counted tree
+// and the leaf of the tree with the prefix compression.
+func (t *Tree[K, V]) giveState(n *node[K, V]) {
+	if n.state == nil && (t.latched || t.counted && !n.leaf || t.prefixCompression && n.leaf) {
+		n.state = &nodeState{}
 	}
+}
 
-	return -1
+// drop releases the node removed from the tree.
+func (t *Tree[K, V]) drop(n *node[K, V]) {
+	if n.frame != nil {
+		n.frame.store.release(n)
+	} else if t.allocator != nil && n.generation == t.generation {
+		// the nodes of the other generations might be shared
+		// with the snapshots and the versions of the tree
+		t.allocator.release(n)
+	}
 }
 
-// append apppends key and the pointer to the node
-func (n *node) append(key []byte, p *pointer) {
-	keyPosition := n.keyNum
-	pointerPosition := n.keyNum
-	if !n.leaf && n.pointers[pointerPosition] != nil {
-		pointerPosition++
+// top returns the root to descend from. The file-backed tree evicts the cold
+// nodes before every descent, since the operations do not keep the nodes
+// between the descents, except the leaves pinned by the cursors.
+func (t *Tree[K, V]) top() *node[K, V] {
+	if t.store != nil {
+		t.store.evict()
 	}
 
-	n.keys[keyPosition] = key
-	n.pointers[pointerPosition] = p
-	n.keyNum++
+	return t.root
+}
 
-	if !n.leaf {
-		p.asNode().parent = n
+// entryNum returns the number of keys in the subtree of the node.
+// Only relevant for the tree in the counted mode.
+func (n *node[K, V]) entryNum() int {
+	if n.leaf {
+		return n.keyNum
 	}
+
+	return n.state.count
 }
 
-// deleteAt deletes the entry at the position and shifts
-// the keys and the pointers.
-func (n *node) deleteAt(keyPosition int, pointerPosition int) {
-	// shift the keys
-	for j := keyPosition; j < n.keyNum-1; j++ {
-		n.keys[j] = n.keys[j+1]
+// recount recalculates the number of keys in the subtree of the internal node
+// from its children.
+func (n *node[K, V]) recount() {
+	n.state.count = 0
+	for i := 0; i <= n.keyNum; i++ {
+		n.state.count += n.child(i).entryNum()
 	}
-	n.keys[n.keyNum-1] = nil
+}
 
-	pointerNum := n.keyNum
-	if !n.leaf {
-		pointerNum++
+// copyFromRight copies the keys and the values or the children from the given
+// node. The split key between the internal nodes must be appended before,
+// so the first child of the given node goes right after it.
+func (n *node[K, V]) copyFromRight(from *node[K, V]) {
+	if n.leaf {
+		if n.frame != nil {
+			n.frame.next = from.frame.next
+		}
+
+		if len(n.prefix()) > 0 || len(from.prefix()) > 0 {
+			// the suffixes are rebuilt for the prefix of the node
+			for i := 0; i < from.keyNum; i++ {
+				n.appendValue(from.key(i), from.values[i])
+			}
+
+			return
+		}
+
+		copy(n.values[n.keyNum:], from.values[:from.keyNum])
+	} else {
+		copy(n.children[n.keyNum:], from.children[:from.keyNum+1])
 	}
-	// shift the pointers
-	for j := pointerPosition; j < pointerNum-1; j++ {
-		n.pointers[j] = n.pointers[j+1]
+
+	copy(n.keys[n.keyNum:], from.keys[:from.keyNum])
+	n.keyNum += from.keyNum
+}
+
+// childPosition returns the position of the child of the internal node
+// to the subtree that might contain the key.
+func (n *node[K, V]) childPosition(key K, compare func(x, y K) int) int {
+	position, found := search(n.keys[:n.keyNum], key, compare)
+	if found {
+		// the keys equal to the separator are in the right subtree
+		position++
 	}
-	n.pointers[pointerNum-1] = nil
 
-	n.keyNum--
+	return position
 }
 
-// pointerPositionOf finds the pointer position of the given node.
-// Returns -1 if it is not found.
-func (n *node) pointerPositionOf(x *node) int {
-	for position, pointer := range n.pointers {
-		if pointer == nil {
-			// reached the end
-			break
-		}
+// keyPosition returns the position of the key, but -1 if it is not present.
+func (n *node[K, V]) keyPosition(key K, compare func(x, y K) int) int {
+	position, found := n.locate(key, compare)
+	if !found {
+		return -1
+	}
 
-		if pointer.asNode() == x {
-			return position
+	return position
+}
+
+// search returns the position of the first of the sorted keys that is
+// greater than or equal to the key, and true if it is equal to the key.
+// The binary search takes O(log n) comparisons, so the wide nodes
+// of the trees with large orders are searched as fast as the narrow ones.
+func search[K any](keys []K, key K, compare func(x, y K) int) (int, bool) {
+	low, high, found := 0, len(keys), false
+	for low < high {
+		middle := int(uint(low+high) >> 1)
+		if c := compare(keys[middle], key); c < 0 {
+			low = middle + 1
+		} else {
+			// the last key that is not less than the key is the found one
+			high, found = middle, c == 0
 		}
 	}
 
-	// pointer not found
-	return -1
+	return low, found
 }
 
-// insertAt inserts the specified key and pointer at the specified position.
-// Only works with leaf nodes.
-func (n *node) insertAt(keyPosition int, key []byte, pointerPosition int, pointer *pointer) {
-	for j := n.keyNum; j > keyPosition; j-- {
-		n.keys[j] = n.keys[j-1]
+// searchBytes is search of the byte-slice keys in the bytes.Compare order.
+func searchBytes(keys [][]byte, key []byte) (int, bool) {
+	low, high, found := 0, len(keys), false
+	for low < high {
+		middle := int(uint(low+high) >> 1)
+		if c := bytes.Compare(keys[middle], key); c < 0 {
+			low = middle + 1
+		} else {
+			high, found = middle, c == 0
+		}
 	}
 
-	pointerNum := n.keyNum
-	if !n.leaf {
-		pointerNum += 1
-	}
+	return low, found
+}
+
+// appendValue appends the key and the value to the leaf node.
+func (n *node[K, V]) appendValue(key K, value V) {
+	// the prefix is shortened before the key is appended
+	key = n.suffix(key)
+
+	n.keys[n.keyNum] = key
+	n.values[n.keyNum] = value
+	n.keyNum++
+}
+
+// appendChild appends the key and the child right of it to the internal node.
+func (n *node[K, V]) appendChild(key K, child *node[K, V]) {
+	n.keys[n.keyNum] = key
+	n.children[n.keyNum+1] = child
+	n.keyNum++
+}
+
+// deleteAt deletes the key at the key position and the value at the same
+// position of the leaf node, or the child at the child position of the internal
+// node, and shifts the keys and the values or the children.
+func (n *node[K, V]) deleteAt(keyPosition int, childPosition int) {
+	// shift the keys
+	copy(n.keys[keyPosition:], n.keys[keyPosition+1:n.keyNum])
+	var zeroKey K
+	n.keys[n.keyNum-1] = zeroKey
 
-	for j := pointerNum; j > pointerPosition; j-- {
-		n.pointers[j] = n.pointers[j-1]
+	if n.leaf {
+		copy(n.values[keyPosition:], n.values[keyPosition+1:n.keyNum])
+		var zeroValue V
+		n.values[n.keyNum-1] = zeroValue
+	} else {
+		copy(n.children[childPosition:], n.children[childPosition+1:n.keyNum+1])
+		n.children[n.keyNum] = nil
 	}
 
-	n.keys[keyPosition] = key
-	n.pointers[pointerPosition] = pointer
+	n.keyNum--
+}
+
+// insertValueAt inserts the key and the value at the position of the leaf node.
+func (n *node[K, V]) insertValueAt(position int, key K, value V) {
+	// the prefix is shortened before the keys are shifted
+	key = n.suffix(key)
+
+	copy(n.keys[position+1:], n.keys[position:n.keyNum])
+	copy(n.values[position+1:], n.values[position:n.keyNum])
+
+	n.keys[position] = key
+	n.values[position] = value
 	n.keyNum++
 }
 
-// setNext sets the "next" pointer (the last pointer) to the next node. Only relevant
-// for the leaf nodes.
-func (n *node) setNext(p *pointer) {
-	n.pointers[len(n.pointers)-1] = p
+// insertChildAt inserts the key and the child at their positions
+// of the internal node.
+func (n *node[K, V]) insertChildAt(keyPosition int, key K, childPosition int, child *node[K, V]) {
+	copy(n.keys[keyPosition+1:], n.keys[keyPosition:n.keyNum])
+	copy(n.children[childPosition+1:], n.children[childPosition:n.keyNum+1])
+
+	n.keys[keyPosition] = key
+	n.children[childPosition] = child
+	n.keyNum++
 }
 
-// next returns the pointer to the next leaf node. Only relevant
-// for the leaf nodes.
-func (n *node) next() *pointer {
-	return n.pointers[len(n.pointers)-1]
+// path is the stack of the internal nodes on the way from the root to the leaf
+// with the positions of the children that the way goes through. The nodes
+// do not point to their parents, since they might be shared by the versions
+// of the tree, so the operations keep the path instead.
+type path[K, V any] struct {
+	nodes     []*node[K, V]
+	positions []int
 }
 
-// pointer wraps the node or the value.
-type pointer struct {
-	value interface{}
+// push adds the node and the position of the child to the path.
+func (p *path[K, V]) push(n *node[K, V], position int) {
+	p.nodes = append(p.nodes, n)
+	p.positions = append(p.positions, position)
 }
 
-// asNode returns a asNode instance of the pointer.
-func (p *pointer) asNode() *node {
-	return p.value.(*node)
+// reset empties the path and keeps its slices for the next path,
+// which is as long unless the height of the tree changes.
+func (p *path[K, V]) reset() {
+	clear(p.nodes[:cap(p.nodes)])
+	p.nodes, p.positions = p.nodes[:0], p.positions[:0]
 }
 
-// asValue returns a asValue instance of the value.
-func (p *pointer) asValue() []byte {
-	return p.value.([]byte)
+// pop removes the last node from the path.
+func (p *path[K, V]) pop() {
+	p.nodes = p.nodes[:len(p.nodes)-1]
+	p.positions = p.positions[:len(p.positions)-1]
 }
 
-// overrideValue overrides the value
-func (p *pointer) overrideValue(newValue []byte) []byte {
-	oldValue := p.value.([]byte)
-	p.value = newValue
+// child returns the child of the internal node at the position.
+// The child of the file-backed tree is loaded from its page if it is evicted.
+func (n *node[K, V]) child(position int) *node[K, V] {
+	c := n.children[position]
+	if c.frame != nil {
+		c.frame.store.access(c)
+	}
 
-	return oldValue
+	return c
 }
 
-func compare(x, y []byte) int {
-	return bytes.Compare(x, y)
+// less returns true if x is less than y according to the comparator of the tree.
+func (t *Tree[K, V]) less(x, y K) bool {
+	return t.compare(x, y) < 0
 }
 
-func less(x, y []byte) bool {
-	return compare(x, y) < 0
+// storedKey returns the key the way it is stored in the tree.
+func (t *Tree[K, V]) storedKey(key K) K {
+	if t.copyKey == nil {
+		return key
+	}
+
+	if t.allocator != nil && t.allocator.arena != nil {
+		// only the byte-slice keys are copied
+		return keyOf[K](t.allocator.arena.copy(bytesOf(key)))
+	}
+
+	return t.copyKey(key)
 }
 
 func copyBytes(s []byte) []byte {
@@ -2,6 +2,7 @@ package bptree
 
 import (
 	"bytes"
+	"cmp"
 	"encoding/binary"
 	"fmt"
 	"math/rand"
@@ -19,6 +20,13 @@ func TestOrderError(t *testing.T) {
 	}
 }
 
+func TestComparatorError(t *testing.T) {
+	_, err := New(Comparator[[]byte](nil))
+	if err == nil {
+		t.Fatal("must return an error, but it does not")
+	}
+}
+
 func Example() {
 	tree, _ := New()
 
@@ -232,7 +240,7 @@ func TestKeyOrder(t *testing.T) {
 
 	if len(keys) == 0 {
 		t.Fatal("keys are empty")
-	}	
+	}
 	isSorted := sort.SliceIsSorted(keys, func(i, j int) bool {
 		return keys[i] < keys[j]
 	})
@@ -440,16 +448,624 @@ func TestForEachAfterDeletion(t *testing.T) {
 	}
 }
 
-func TestNonExistentPointerPositionOf(t *testing.T) {
+func TestForEachReverse(t *testing.T) {
+	tree, _ := New()
+	for _, c := range treeCases {
+		tree.Put([]byte{c.key}, []byte(c.value))
+	}
+
+	actual := make([]byte, 0)
+	tree.ForEachReverse(func(key []byte, value []byte) {
+		actual = append(actual, key...)
+	})
+
+	expected := make([]byte, 0)
+	for _, c := range treeCases {
+		expected = append(expected, c.key)
+	}
+	sort.Slice(expected, func(i, j int) bool {
+		return expected[i] > expected[j]
+	})
+
+	if !reflect.DeepEqual(expected, actual) {
+		t.Fatalf("%v != %v", expected, actual)
+	}
+}
+
+func ExampleBPTree_ScanPrefix() {
+	tree, _ := New()
+
+	tree.Put([]byte("tenant/1/user/1"), []byte("alice"))
+	tree.Put([]byte("tenant/1/user/2"), []byte("bob"))
+	tree.Put([]byte("tenant/2/user/1"), []byte("carol"))
+
+	tree.ScanPrefix([]byte("tenant/1/"), func(key, value []byte) {
+		fmt.Printf("key = %s, value = %s\n", string(key), string(value))
+	})
+
+	// Output:
+	// key = tenant/1/user/1, value = alice
+	// key = tenant/1/user/2, value = bob
+}
+
+func ExampleBPTree_Floor() {
+	tree, _ := New()
+
+	tree.Put([]byte("v1"), []byte("first"))
+	tree.Put([]byte("v3"), []byte("third"))
+	tree.Put([]byte("v5"), []byte("fifth"))
+
+	key, value, ok := tree.Floor([]byte("v4"))
+	fmt.Printf("key = %s, value = %s, ok = %v\n", string(key), string(value), ok)
+
+	// Output:
+	// key = v3, value = third, ok = true
+}
+
+func TestNavigation(t *testing.T) {
+	sorted := make([]byte, 0)
+	for _, c := range treeCases {
+		sorted = append(sorted, c.key)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i] < sorted[j]
+	})
+
+	// reference implementations over the sorted keys
+	floor := func(k byte, inclusive bool) (byte, bool) {
+		for i := len(sorted) - 1; i >= 0; i-- {
+			if sorted[i] < k || (inclusive && sorted[i] == k) {
+				return sorted[i], true
+			}
+		}
+		return 0, false
+	}
+	ceiling := func(k byte, inclusive bool) (byte, bool) {
+		for _, s := range sorted {
+			if s > k || (inclusive && s == k) {
+				return s, true
+			}
+		}
+		return 0, false
+	}
+
+	lookups := []struct {
+		name      string
+		lookup    func(tree *BPTree, key []byte) ([]byte, []byte, bool)
+		reference func(k byte) (byte, bool)
+	}{
+		{"Floor", (*BPTree).Floor, func(k byte) (byte, bool) { return floor(k, true) }},
+		{"Lower", (*BPTree).Lower, func(k byte) (byte, bool) { return floor(k, false) }},
+		{"Ceiling", (*BPTree).Ceiling, func(k byte) (byte, bool) { return ceiling(k, true) }},
+		{"Higher", (*BPTree).Higher, func(k byte) (byte, bool) { return ceiling(k, false) }},
+	}
+
+	for order := 3; order <= 7; order++ {
+		tree, _ := New(Order(order))
+		for _, c := range treeCases {
+			tree.Put([]byte{c.key}, []byte(c.value))
+		}
+
+		for _, l := range lookups {
+			for k := 0; k <= 80; k++ {
+				key, value, ok := l.lookup(tree, []byte{byte(k)})
+				expected, expectedOk := l.reference(byte(k))
+
+				if ok != expectedOk {
+					t.Fatalf("%s(%d), order %d: expected ok %v, but got %v", l.name, k, order, expectedOk, ok)
+				}
+				if !ok {
+					if key != nil || value != nil {
+						t.Fatalf("%s(%d), order %d: expected nil key and value", l.name, k, order)
+					}
+					continue
+				}
+				if key[0] != expected {
+					t.Fatalf("%s(%d), order %d: expected key %d, but got %d", l.name, k, order, expected, key[0])
+				}
+				if string(value) != strconv.Itoa(int(expected)) {
+					t.Fatalf("%s(%d), order %d: unexpected value %s", l.name, k, order, value)
+				}
+			}
+		}
+	}
+}
+
+func TestNavigationForEmptyTree(t *testing.T) {
+	tree, _ := New()
+
+	lookups := []func(key []byte) ([]byte, []byte, bool){tree.Floor, tree.Ceiling, tree.Lower, tree.Higher}
+	for _, lookup := range lookups {
+		if _, _, ok := lookup([]byte{1}); ok {
+			t.Fatal("expected ok to be false for the empty tree")
+		}
+	}
+}
+
+func ExampleComparator() {
+	reverse := func(x, y []byte) int {
+		return bytes.Compare(y, x)
+	}
+
+	tree, _ := New(Comparator(reverse))
+
+	tree.Put([]byte("apple"), []byte("sweet"))
+	tree.Put([]byte("banana"), []byte("honey"))
+	tree.Put([]byte("cinnamon"), []byte("savoury"))
+
+	tree.ForEach(func(key, value []byte) {
+		fmt.Printf("key = %s, value = %s\n", string(key), string(value))
+	})
+
+	// Output:
+	// key = cinnamon, value = savoury
+	// key = banana, value = honey
+	// key = apple, value = sweet
+}
+
+func TestReverseComparator(t *testing.T) {
+	reverse := func(x, y []byte) int {
+		return bytes.Compare(y, x)
+	}
+
+	r := rand.New(rand.NewSource(time.Now().Unix()))
+	size := 1000
+
+	for order := 3; order <= 7; order++ {
+		tree, _ := New(Order(order), Comparator(reverse), Counted())
+		for _, k := range r.Perm(size) {
+			tree.Put(rankKey(k), rankKey(k))
+		}
+		for k := 0; k < size; k += 3 {
+			tree.Delete(rankKey(k))
+		}
+		assertInvariants(t, tree.Tree)
+
+		expected := make([]int, 0)
+		for k := size - 1; k >= 0; k-- {
+			if k%3 != 0 {
+				expected = append(expected, k)
+			}
+		}
+
+		actual := make([]int, 0)
+		tree.ForEach(func(key, value []byte) {
+			actual = append(actual, int(binary.BigEndian.Uint32(key)))
+		})
+		if !reflect.DeepEqual(expected, actual) {
+			t.Fatalf("order %d: %v != %v", order, expected, actual)
+		}
+
+		key, _, _ := tree.Min()
+		if binary.BigEndian.Uint32(key) != 998 {
+			t.Fatalf("order %d: expected min %d, but got %v", order, 998, key)
+		}
+
+		key, _, _ = tree.Floor(rankKey(501))
+		if binary.BigEndian.Uint32(key) != 502 {
+			t.Fatalf("order %d: expected floor %d, but got %v", order, 502, key)
+		}
+
+		rank, ok := tree.Rank(rankKey(997))
+		if !ok || rank != 1 {
+			t.Fatalf("order %d: expected rank 1, but got %d (%v)", order, rank, ok)
+		}
+
+		count := 0
+		for it := tree.Range(rankKey(10), rankKey(0)); it.HasNext(); it.Next() {
+			count++
+		}
+		if count != 7 || tree.CountRange(rankKey(10), rankKey(0)) != 7 {
+			t.Fatalf("order %d: expected 7 keys in the range [10, 0), but got %d", order, count)
+		}
+
+		if deleted := tree.DeleteRange(rankKey(10), rankKey(0)); deleted != 7 {
+			t.Fatalf("order %d: expected to delete 7 keys, but deleted %d", order, deleted)
+		}
+		assertInvariants(t, tree.Tree)
+	}
+}
+
+func TestCaseInsensitiveComparator(t *testing.T) {
+	caseInsensitive := func(x, y []byte) int {
+		return bytes.Compare(bytes.ToLower(x), bytes.ToLower(y))
+	}
+
+	tree, _ := New(Order(3), Comparator(caseInsensitive))
+
+	tree.Put([]byte("Banana"), []byte("1"))
+	tree.Put([]byte("apple"), []byte("2"))
+	tree.Put([]byte("cinnamon"), []byte("3"))
+
+	prev, exists := tree.Put([]byte("BANANA"), []byte("4"))
+	if !exists || string(prev) != "1" {
+		t.Fatalf("expected to override the value 1, but got %s (%v)", prev, exists)
+	}
+
+	value, ok := tree.Get([]byte("banana"))
+	if !ok || string(value) != "4" {
+		t.Fatalf("expected to get the value 4, but got %s (%v)", value, ok)
+	}
+
+	keys := make([]string, 0)
+	tree.ForEach(func(key, value []byte) {
+		keys = append(keys, string(key))
+	})
+	if !reflect.DeepEqual([]string{"apple", "Banana", "cinnamon"}, keys) {
+		t.Fatalf("unexpected order of keys: %v", keys)
+	}
+
+	if _, ok := tree.Delete([]byte("CINNAMON")); !ok {
+		t.Fatal("expected to delete the key")
+	}
+	if tree.Size() != 2 {
+		t.Fatalf("expected size 2, but got %d", tree.Size())
+	}
+}
+
+func TestMinAndMax(t *testing.T) {
 	tree, _ := New(Order(3))
 
-	tree.Put([]byte{1}, []byte{2})
-	tree.Put([]byte{2}, []byte{2})
-	tree.Put([]byte{3}, []byte{3})
+	if _, _, ok := tree.Min(); ok {
+		t.Fatal("expected no min for the empty tree")
+	}
+	if _, _, ok := tree.Max(); ok {
+		t.Fatal("expected no max for the empty tree")
+	}
+
+	for _, c := range treeCases {
+		tree.Put([]byte{c.key}, []byte(c.value))
+	}
+
+	key, value, ok := tree.Min()
+	if !ok || key[0] != 0 || string(value) != "0" {
+		t.Fatalf("unexpected min %v = %s (%v)", key, value, ok)
+	}
+
+	key, value, ok = tree.Max()
+	if !ok || key[0] != 74 || string(value) != "74" {
+		t.Fatalf("unexpected max %v = %s (%v)", key, value, ok)
+	}
+}
+
+func TestPopMinAndPopMax(t *testing.T) {
+	for order := 3; order <= 7; order++ {
+		sorted := make([]byte, 0)
+		for _, c := range treeCases {
+			sorted = append(sorted, c.key)
+		}
+		sort.Slice(sorted, func(i, j int) bool {
+			return sorted[i] < sorted[j]
+		})
+
+		tree, _ := New(Order(order))
+		for _, c := range treeCases {
+			tree.Put([]byte{c.key}, []byte(c.value))
+		}
+
+		for popMin := true; len(sorted) > 0; popMin = !popMin {
+			var key, value []byte
+			var ok bool
+			var expected byte
+			if popMin {
+				key, value, ok = tree.PopMin()
+				expected, sorted = sorted[0], sorted[1:]
+			} else {
+				key, value, ok = tree.PopMax()
+				expected, sorted = sorted[len(sorted)-1], sorted[:len(sorted)-1]
+			}
+
+			if !ok {
+				t.Fatalf("order %d: expected to pop %d", order, expected)
+			}
+			if key[0] != expected || string(value) != strconv.Itoa(int(expected)) {
+				t.Fatalf("order %d: expected to pop %d, but got %v = %s", order, expected, key, value)
+			}
+			if tree.Size() != len(sorted) {
+				t.Fatalf("order %d: the expected size != actual: %d != %d", order, len(sorted), tree.Size())
+			}
+		}
+
+		if _, _, ok := tree.PopMin(); ok {
+			t.Fatal("expected nothing to pop from the empty tree")
+		}
+		if _, _, ok := tree.PopMax(); ok {
+			t.Fatal("expected nothing to pop from the empty tree")
+		}
+	}
+}
+
+func TestInvariantsRandomized(t *testing.T) {
+	r := rand.New(rand.NewSource(time.Now().Unix()))
+	size := 2000
+
+	for order := 3; order <= 7; order++ {
+		tree, _ := New(Order(order), Counted())
+
+		for _, k := range r.Perm(size) {
+			key := make([]byte, 4)
+			binary.BigEndian.PutUint32(key, uint32(k))
+			tree.Put(key, key)
+		}
+		assertInvariants(t, tree.Tree)
+
+		for i, k := range r.Perm(size) {
+			key := make([]byte, 4)
+			binary.BigEndian.PutUint32(key, uint32(k))
+			tree.Delete(key)
+
+			if i%97 == 0 {
+				assertInvariants(t, tree.Tree)
+			}
+		}
+		assertInvariants(t, tree.Tree)
+	}
+}
+
+// assertIterators checks that the forward and the reverse
+// iterators traverse the same keys.
+func assertIterators[K, V any](t *testing.T, tree *Tree[K, V]) {
+	t.Helper()
+
+	forward := make([]K, 0)
+	for it := tree.Iterator(); it.HasNext(); {
+		key, _ := it.Next()
+		forward = append(forward, key)
+	}
+
+	backward := make([]K, 0)
+	for it := tree.ReverseIterator(); it.HasNext(); {
+		key, _ := it.Next()
+		backward = append(backward, key)
+	}
+
+	if len(forward) != tree.size || len(backward) != tree.size {
+		t.Fatalf("forward key number %d and backward key number %d != %d", len(forward), len(backward), tree.size)
+	}
+	for i := range forward {
+		if tree.compare(forward[i], backward[len(backward)-1-i]) != 0 {
+			t.Fatalf("key %d is not traversed back", i)
+		}
+	}
+}
+
+// assertInvariants checks the B+ tree properties: sorted keys, separator keys,
+// minimum number of keys, leaf depth, size and iteration in both directions.
+func assertInvariants[K, V any](t *testing.T, tree *Tree[K, V]) {
+	t.Helper()
+
+	if tree.root == nil {
+		if tree.size != 0 {
+			t.Fatalf("the empty tree has size %d", tree.size)
+		}
+
+		return
+	}
+
+	leafDepth := -1
+	size := 0
+
+	// the bounds are unset for the leftmost and the rightmost subtrees
+	var walk func(n *node[K, V], depth int, lower, upper *K)
+	walk = func(n *node[K, V], depth int, lower, upper *K) {
+		if n != tree.root && n.keyNum < tree.minKeyNum {
+			t.Fatalf("the node has %d keys, but the minimum is %d", n.keyNum, tree.minKeyNum)
+		}
+
+		if !n.leaf && len(n.prefix()) > 0 {
+			t.Fatalf("the internal node has the prefix %v", n.prefix())
+		}
+
+		for i := 0; i < n.keyNum; i++ {
+			if i > 0 && !tree.less(n.key(i-1), n.key(i)) {
+				t.Fatalf("the keys %v and %v are not sorted", n.key(i-1), n.key(i))
+			}
+			if lower != nil && tree.less(n.key(i), *lower) {
+				t.Fatalf("the key %v is less than the lower bound %v", n.key(i), *lower)
+			}
+			if upper != nil && !tree.less(n.key(i), *upper) {
+				t.Fatalf("the key %v is not less than the upper bound %v", n.key(i), *upper)
+			}
+		}
+
+		if n.leaf {
+			if leafDepth == -1 {
+				leafDepth = depth
+			} else if leafDepth != depth {
+				t.Fatalf("the leaves are at different depths: %d and %d", leafDepth, depth)
+			}
+
+			size += n.keyNum
 
-	actual := tree.root.pointerPositionOf(tree.root)
-	if actual != -1 {
-		t.Fatalf("should not locate root in the root, but found it")
+			return
+		}
+
+		for i := 0; i <= n.keyNum; i++ {
+			child := n.child(i)
+
+			childLower, childUpper := lower, upper
+			if i > 0 {
+				childLower = &n.keys[i-1]
+			}
+			if i < n.keyNum {
+				childUpper = &n.keys[i]
+			}
+
+			walk(child, depth+1, childLower, childUpper)
+		}
+	}
+	walk(tree.root, 0, nil, nil)
+
+	if size != tree.size {
+		t.Fatalf("the tree has %d keys, but its size is %d", size, tree.size)
+	}
+
+	assertIterators(t, tree)
+	assertCounts(t, tree, tree.root)
+}
+
+func TestSearch(t *testing.T) {
+	for size := 0; size <= 9; size++ {
+		keys := make([]int, size)
+		for i := range keys {
+			keys[i] = i * 2
+		}
+
+		for key := -1; key <= size*2; key++ {
+			expected := 0
+			for expected < size && keys[expected] < key {
+				expected++
+			}
+
+			position, found := search(keys, key, cmp.Compare[int])
+			if position != expected || found != (key%2 == 0 && key >= 0 && key < size*2) {
+				t.Fatalf("search(%v, %d) = %d, %v, expected %d", keys, key, position, found, expected)
+			}
+		}
+	}
+}
+
+func TestPathIsReused(t *testing.T) {
+	tree, _ := NewTree[int, int](Order(3))
+	for i := 0; i < 1000; i++ {
+		tree.Put(i, i)
+	}
+
+	// neither overriding nor deleting the missing key changes the nodes,
+	// so they allocate only if the path is allocated
+	allocs := testing.AllocsPerRun(100, func() {
+		tree.Put(500, 0)
+		tree.Delete(-1)
+	})
+	if allocs != 0 {
+		t.Fatalf("expected no allocations, but got %v", allocs)
+	}
+}
+
+func TestNodeStateIsKeptAside(t *testing.T) {
+	plain, _ := New(Order(3))
+	counted, _ := New(Order(3), Counted())
+	compressed, _ := New(Order(3), PrefixCompression())
+	concurrent, _ := NewConcurrent(Order(3))
+	for i := 0; i < 100; i++ {
+		plain.Put(rankKey(i), nil)
+		counted.Put(rankKey(i), nil)
+		compressed.Put(rankKey(i), nil)
+		concurrent.Put(rankKey(i), nil)
+	}
+
+	// the state of the node is allocated only for the trees that need it
+	for _, c := range []struct {
+		tree           *Tree[[]byte, []byte]
+		leaf, internal bool
+	}{
+		{plain.Tree, false, false},
+		{counted.Tree, false, true},
+		{compressed.Tree, true, false},
+		{concurrent.tree, true, true},
+	} {
+		var walk func(n *node[[]byte, []byte])
+		walk = func(n *node[[]byte, []byte]) {
+			if expected := c.leaf && n.leaf || c.internal && !n.leaf; (n.state != nil) != expected {
+				t.Fatalf("expected the state of the node %v to be allocated: %v", n.keys[:n.keyNum], expected)
+			}
+			for i := 0; !n.leaf && i <= n.keyNum; i++ {
+				walk(n.children[i])
+			}
+		}
+		walk(c.tree.root)
+	}
+}
+
+func TestGetDoesNotAllocate(t *testing.T) {
+	for _, options := range [][]Option{{}, {PrefixCompression()}} {
+		tree, _ := New(append(options, Order(3))...)
+		for i := 0; i < 1000; i++ {
+			tree.Put(rankKey(i), nil)
+		}
+
+		// the key does not escape, so it is converted on the stack
+		key := string(rankKey(500))
+		allocs := testing.AllocsPerRun(100, func() {
+			if _, ok := tree.Get([]byte(key)); !ok {
+				t.Fatalf("key %v is not found", []byte(key))
+			}
+		})
+		if allocs != 0 {
+			t.Fatalf("expected no allocations, but got %v", allocs)
+		}
+	}
+}
+
+func TestShortestSeparator(t *testing.T) {
+	for _, c := range []struct{ x, y, expected string }{
+		{"", "a", "a"},
+		{"a", "b", "b"},
+		{"apple", "banana", "b"},
+		{"apple", "apricot", "apr"},
+		{"app", "apple", "appl"},
+		{"org/1/item/1", "org/1/item/2", "org/1/item/2"},
+		{"org/1/item/19", "org/1/item/2", "org/1/item/2"},
+		{"org/1/item/1", "org/2", "org/2"},
+		{"a\xff", "b\x00", "b"},
+	} {
+		separator := shortestSeparator([]byte(c.x), []byte(c.y))
+		if string(separator) != c.expected {
+			t.Fatalf("shortestSeparator(%q, %q) = %q, expected %q", c.x, c.y, separator, c.expected)
+		}
+		if bytes.Compare([]byte(c.x), separator) >= 0 || bytes.Compare(separator, []byte(c.y)) > 0 {
+			t.Fatalf("%q does not separate %q and %q", separator, c.x, c.y)
+		}
+	}
+}
+
+func TestSeparatorTruncation(t *testing.T) {
+	shortest, _ := New(Order(4))
+	full, _ := New(Order(4), Comparator(bytes.Compare))
+	function, _ := NewTreeFunc[[]byte, []byte](bytes.Compare, Order(4))
+
+	expected := make(map[string][]byte)
+	for i := 0; i < 1000; i++ {
+		key := []byte(fmt.Sprintf("%03d/%s", i, bytes.Repeat([]byte{'x'}, 100)))
+		shortest.Put(key, key)
+		full.Put(key, key)
+		function.Put(key, key)
+		expected[string(key)] = key
+	}
+	for i := 0; i < 1000; i += 3 {
+		key := []byte(fmt.Sprintf("%03d/%s", i, bytes.Repeat([]byte{'x'}, 100)))
+		shortest.Delete(key)
+		delete(expected, string(key))
+	}
+
+	assertContents(t, shortest, expected)
+
+	loaded, _ := NewFromSorted(full.Iterator(), 1)
+
+	// the keys differ in the first three bytes, so do the separators
+	for _, tree := range []*Tree[[]byte, []byte]{shortest.Tree, loaded.Tree} {
+		assertSeparators(t, tree.root, func(key []byte) bool { return len(key) <= 3 })
+	}
+	for _, tree := range []*Tree[[]byte, []byte]{full.Tree, function} {
+		assertSeparators(t, tree.root, func(key []byte) bool { return len(key) == 104 })
+	}
+}
+
+// assertSeparators checks the keys of the internal nodes of the subtree.
+func assertSeparators(t *testing.T, n *node[[]byte, []byte], valid func(key []byte) bool) {
+	t.Helper()
+
+	if n.leaf {
+		return
+	}
+
+	for i := 0; i < n.keyNum; i++ {
+		if !valid(n.keys[i]) {
+			t.Fatalf("unexpected separator %q", n.keys[i])
+		}
+	}
+	for i := 0; i <= n.keyNum; i++ {
+		assertSeparators(t, n.children[i], valid)
 	}
 }
 
@@ -545,6 +1161,95 @@ func BenchmarkTreeGet(b *testing.B) {
 	}
 }
 
+// the orders of the trees benchmarked against each other
+var benchmarkOrders = []int{4, 16, 64, 256, 1024}
+
+func BenchmarkTreeGetByOrder(b *testing.B) {
+	for _, order := range benchmarkOrders {
+		b.Run(fmt.Sprintf("order=%d", order), func(b *testing.B) {
+			BenchmarkTree, _ = New(Order(order))
+			for k := benchmarkKeyNum; k > 0; k-- {
+				key := strconv.Itoa(k)
+				BenchmarkTree.Put([]byte(key), []byte(key))
+			}
+
+			b.ResetTimer()
+
+			for n := 0; n < b.N; n++ {
+				for k := 0; k < benchmarkKeyNum; k++ {
+					key := strconv.Itoa(k)
+					BenchmarkValue, _ = BenchmarkTree.Get([]byte(key))
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkTreePutByOrder(b *testing.B) {
+	for _, order := range benchmarkOrders {
+		b.Run(fmt.Sprintf("order=%d", order), func(b *testing.B) {
+			for n := 0; n < b.N; n++ {
+				BenchmarkTree, _ = New(Order(order))
+
+				for k := benchmarkKeyNum; k > 0; k-- {
+					key := strconv.Itoa(k)
+					BenchmarkTree.Put([]byte(key), []byte(key))
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkTreeGetLongKeys(b *testing.B) {
+	keys := make([][]byte, benchmarkKeyNum)
+	for k := range keys {
+		keys[k] = []byte(fmt.Sprintf("%05d/%s", k, bytes.Repeat([]byte{'x'}, 200)))
+	}
+
+	// the separators are not shortened with a custom comparator
+	for _, c := range []struct {
+		name    string
+		options []Option
+	}{
+		{"separators=shortest", nil},
+		{"separators=full", []Option{Comparator(bytes.Compare)}},
+	} {
+		b.Run(c.name, func(b *testing.B) {
+			BenchmarkTree, _ = New(append(c.options, Order(64))...)
+			for _, key := range keys {
+				BenchmarkTree.Put(key, key)
+			}
+
+			b.ResetTimer()
+
+			for n := 0; n < b.N; n++ {
+				for _, key := range keys {
+					BenchmarkValue, _ = BenchmarkTree.Get(key)
+				}
+			}
+
+			b.ReportMetric(float64(separatorBytes(BenchmarkTree.root)), "separator-bytes")
+		})
+	}
+}
+
+// separatorBytes returns the total length of the keys of the internal nodes of the subtree.
+func separatorBytes(n *node[[]byte, []byte]) int {
+	if n.leaf {
+		return 0
+	}
+
+	total := 0
+	for i := 0; i < n.keyNum; i++ {
+		total += len(n.keys[i])
+	}
+	for i := 0; i <= n.keyNum; i++ {
+		total += separatorBytes(n.children[i])
+	}
+
+	return total
+}
+
 func BenchmarkTreePutAndForEach(b *testing.B) {
 	for n := 0; n < b.N; n++ {
 		BenchmarkTree, _ = New()
@@ -0,0 +1,181 @@
+package bptree
+
+import (
+	"fmt"
+	"math"
+)
+
+// KeyValueIterator iterates over the key-value pairs. Iterator
+// implements it, so one tree can be loaded from another.
+type KeyValueIterator = TreeKeyValueIterator[[]byte, []byte]
+
+// TreeKeyValueIterator iterates over the key-value pairs of type K and V.
+// TreeIterator implements it, so one tree can be loaded from another.
+type TreeKeyValueIterator[K, V any] interface {
+	HasNext() bool
+	Next() (K, V)
+}
+
+// NewFromSorted returns a new instance of the B+ tree built from the given
+// key-value pairs that must be sorted in ascending key order without duplicates.
+// The leaf nodes are packed bottom-up and filled up to the fill factor
+// in the range (0, 1], and the internal nodes are built directly above them,
+// which is much faster than calling Put for every key.
+func NewFromSorted(it KeyValueIterator, fillFactor float64, options ...Option) (*BPTree, error) {
+	t, err := New(options...)
+	if err != nil {
+		return nil, err
+	}
+
+	err = t.load(it, fillFactor)
+	if err != nil {
+		return nil, err
+	}
+
+	return t, nil
+}
+
+// load builds the empty tree from the sorted key-value pairs bottom-up.
+func (t *Tree[K, V]) load(it TreeKeyValueIterator[K, V], fillFactor float64) error {
+	if fillFactor <= 0 || fillFactor > 1 {
+		return fmt.Errorf("fill factor must be in (0, 1]")
+	}
+
+	leaves, err := t.buildLeaves(it, fillFactor)
+	if err != nil {
+		return err
+	}
+
+	if len(leaves) == 0 {
+		return nil
+	}
+
+	for _, leaf := range leaves {
+		t.compress(leaf)
+	}
+
+	level := leaves
+	for len(level) > 1 {
+		level = t.buildParents(level, fillFactor)
+	}
+
+	t.root = level[0]
+
+	return nil
+}
+
+// buildLeaves packs the sorted key-value pairs into the leaf nodes.
+func (t *Tree[K, V]) buildLeaves(it TreeKeyValueIterator[K, V], fillFactor float64) ([]*node[K, V], error) {
+	capacity := t.order - 1
+	target := fillTarget(fillFactor, capacity, t.minKeyNum)
+
+	leaves := make([]*node[K, V], 0)
+	var previousKey K
+	for it.HasNext() {
+		key, value := it.Next()
+		if t.size > 0 && !t.less(previousKey, key) {
+			return nil, fmt.Errorf("keys must be sorted in ascending order without duplicates: %v goes after %v", key, previousKey)
+		}
+		previousKey = key
+
+		if len(leaves) == 0 || leaves[len(leaves)-1].keyNum == target {
+			leaf := t.newNode(true)
+			if len(leaves) > 0 && leaf.frame != nil {
+				leaves[len(leaves)-1].frame.next = leaf.frame.page
+			}
+
+			leaves = append(leaves, leaf)
+		}
+
+		leaves[len(leaves)-1].appendValue(t.storedKey(key), t.storedValue(value))
+		t.size++
+	}
+
+	if len(leaves) < 2 {
+		return leaves, nil
+	}
+
+	// the last leaf might not have enough keys,
+	// so it is merged with the previous one or borrows from it
+	last, previous := leaves[len(leaves)-1], leaves[len(leaves)-2]
+	if last.keyNum >= t.minKeyNum {
+		return leaves, nil
+	}
+
+	total := previous.keyNum + last.keyNum
+	if total <= capacity {
+		previous.copyFromRight(last)
+		t.drop(last)
+
+		return leaves[:len(leaves)-1], nil
+	}
+
+	for last.keyNum < total/2 {
+		last.insertValueAt(0, previous.key(previous.keyNum-1), previous.values[previous.keyNum-1])
+		previous.deleteAt(previous.keyNum-1, previous.keyNum-1)
+	}
+
+	return leaves, nil
+}
+
+// buildParents builds the level of the internal nodes above the given nodes.
+func (t *Tree[K, V]) buildParents(children []*node[K, V], fillFactor float64) []*node[K, V] {
+	capacity := t.order
+	minimum := t.minKeyNum + 1
+	target := fillTarget(fillFactor, capacity, minimum)
+	if len(children) <= capacity {
+		// the root can have less than the minimum number of children
+		target = len(children)
+	}
+
+	// split the children into the chunks of the target size,
+	// but the last chunk might be too small, so it is merged with
+	// the previous one or the both chunks are evened out
+	sizes := make([]int, 0, ceil(len(children), target))
+	for rest := len(children); rest > 0; rest -= target {
+		size := target
+		if rest < target {
+			size = rest
+		}
+
+		sizes = append(sizes, size)
+	}
+	if last := len(sizes) - 1; last > 0 && sizes[last] < minimum {
+		total := sizes[last-1] + sizes[last]
+		if total <= capacity {
+			sizes[last-1] = total
+			sizes = sizes[:last]
+		} else {
+			sizes[last-1], sizes[last] = total-total/2, total/2
+		}
+	}
+
+	parents := make([]*node[K, V], 0, len(sizes))
+	for _, size := range sizes {
+		parent := t.newNode(false)
+		parent.children[0] = children[0]
+		for i, child := range children[1:size] {
+			parent.appendChild(t.separatorBetween(children[i], child), child)
+		}
+
+		if t.counted {
+			parent.recount()
+		}
+
+		parents = append(parents, parent)
+		children = children[size:]
+	}
+
+	return parents
+}
+
+// fillTarget returns the number of entries in the node for the given fill factor,
+// but not less than the minimum.
+func fillTarget(fillFactor float64, capacity, minimum int) int {
+	target := int(math.Ceil(fillFactor * float64(capacity)))
+	if target < minimum {
+		return minimum
+	}
+
+	return target
+}
@@ -0,0 +1,138 @@
+package bptree
+
+import (
+	"fmt"
+	"testing"
+)
+
+func ExampleNewFromSorted() {
+	source, _ := New()
+	source.Put([]byte("apple"), []byte("sweet"))
+	source.Put([]byte("banana"), []byte("honey"))
+	source.Put([]byte("cinnamon"), []byte("savoury"))
+
+	tree, err := NewFromSorted(source.Iterator(), 1.0)
+	if err != nil {
+		fmt.Printf("error: %v\n", err)
+		return
+	}
+
+	tree.ForEach(func(key, value []byte) {
+		fmt.Printf("key = %s, value = %s\n", string(key), string(value))
+	})
+
+	// Output:
+	// key = apple, value = sweet
+	// key = banana, value = honey
+	// key = cinnamon, value = savoury
+}
+
+// sliceIterator iterates over the keys of the slice with the same values.
+type sliceIterator struct {
+	keys [][]byte
+}
+
+func (it *sliceIterator) HasNext() bool {
+	return len(it.keys) > 0
+}
+
+func (it *sliceIterator) Next() ([]byte, []byte) {
+	key := it.keys[0]
+	it.keys = it.keys[1:]
+
+	return key, key
+}
+
+func TestNewFromSorted(t *testing.T) {
+	for order := 3; order <= 8; order++ {
+		for _, fillFactor := range []float64{0.01, 0.5, 0.7, 1.0} {
+			for _, size := range []int{0, 1, 2, 3, 5, 8, 13, 100, 1000} {
+				keys := make([][]byte, size)
+				for i := range keys {
+					keys[i] = rankKey(2 * i)
+				}
+
+				tree, err := NewFromSorted(&sliceIterator{keys}, fillFactor, Order(order), Counted())
+				if err != nil {
+					t.Fatalf("order %d, fill factor %v, size %d: %v", order, fillFactor, size, err)
+				}
+				assertInvariants(t, tree.Tree)
+
+				for i, key := range keys {
+					value, ok := tree.Get(key)
+					if !ok || string(value) != string(key) {
+						t.Fatalf("order %d, fill factor %v, size %d: key %v is not found", order, fillFactor, size, key)
+					}
+
+					rank, _ := tree.Rank(key)
+					if rank != i {
+						t.Fatalf("order %d, fill factor %v, size %d: expected rank %d, but got %d", order, fillFactor, size, i, rank)
+					}
+				}
+
+				// the tree must stay valid for the further changes
+				for i := 0; i < size; i++ {
+					tree.Put(rankKey(2*i+1), nil)
+				}
+				assertInvariants(t, tree.Tree)
+				for i := 0; i < 2*size; i += 3 {
+					tree.Delete(rankKey(i))
+				}
+				assertInvariants(t, tree.Tree)
+			}
+		}
+	}
+}
+
+func TestNewFromSortedFullLeaves(t *testing.T) {
+	keys := make([][]byte, 100)
+	for i := range keys {
+		keys[i] = rankKey(i)
+	}
+
+	tree, _ := NewFromSorted(&sliceIterator{keys}, 1.0, Order(5))
+
+	leaves := 0
+	for c := tree.first(); c.valid(); c.nextLeaf() {
+		leaves++
+	}
+
+	if leaves != 25 {
+		t.Fatalf("expected 25 full leaves, but got %d", leaves)
+	}
+}
+
+func TestNewFromSortedCopiesKeys(t *testing.T) {
+	key := []byte{1}
+	tree, _ := NewFromSorted(&sliceIterator{[][]byte{key}}, 1.0)
+
+	key[0] = 2
+	if _, ok := tree.Get([]byte{1}); !ok {
+		t.Fatal("the key must be copied")
+	}
+}
+
+func TestNewFromSortedErrors(t *testing.T) {
+	cases := []struct {
+		name       string
+		keys       [][]byte
+		fillFactor float64
+		options    []Option
+	}{
+		{"unsorted", [][]byte{{1}, {3}, {2}}, 1.0, nil},
+		{"duplicates", [][]byte{{1}, {2}, {2}}, 1.0, nil},
+		{"zero fill factor", [][]byte{{1}}, 0, nil},
+		{"too big fill factor", [][]byte{{1}}, 1.1, nil},
+		{"invalid order", [][]byte{{1}}, 1.0, []Option{Order(2)}},
+	}
+
+	for _, c := range cases {
+		tree, err := NewFromSorted(&sliceIterator{c.keys}, c.fillFactor, c.options...)
+		if err == nil {
+			t.Fatalf("%s: must return an error, but it does not", c.name)
+		}
+		if tree != nil {
+			t.Fatalf("%s: the tree must be nil", c.name)
+		}
+	}
+}
@@ -0,0 +1,503 @@
+package bptree
+
+import (
+	"cmp"
+	"fmt"
+	"sync"
+	"sync/atomic"
+)
+
+// ConcurrentBPTree is a goroutine-safe implementation of the B+ tree
+// with byte-slice keys and values.
+type ConcurrentBPTree struct {
+	*ConcurrentTree[[]byte, []byte]
+}
+
+// NewConcurrent returns a new instance of the goroutine-safe B+ tree.
+// The counted mode is not supported.
+func NewConcurrent(options ...Option) (*ConcurrentBPTree, error) {
+	o, err := newInMemoryOptions(options)
+	if err != nil {
+		return nil, err
+	}
+
+	t, err := newBytesTree(o)
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := newConcurrentTree(t)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ConcurrentBPTree{c}, nil
+}
+
+// NewConcurrentTree returns a new instance of the goroutine-safe B+ tree
+// with ordered keys of type K and values of type V.
+func NewConcurrentTree[K cmp.Ordered, V any](options ...Option) (*ConcurrentTree[K, V], error) {
+	t, err := NewTree[K, V](options...)
+	if err != nil {
+		return nil, err
+	}
+
+	return newConcurrentTree(t)
+}
+
+// NewConcurrentTreeFunc returns a new instance of the goroutine-safe B+ tree
+// with keys of any type ordered by the given comparator.
+func NewConcurrentTreeFunc[K, V any](compare func(x, y K) int, options ...Option) (*ConcurrentTree[K, V], error) {
+	t, err := NewTreeFunc[K, V](compare, options...)
+	if err != nil {
+		return nil, err
+	}
+
+	return newConcurrentTree(t)
+}
+
+// ConcurrentTree is a goroutine-safe implementation of the B+ tree
+// with keys of type K and values of type V.
+//
+// It uses latch crabbing: an operation descends from the root and releases
+// the latch of a node only after it acquires the latch of the child, so readers
+// and writers in different subtrees proceed in parallel. Writers first try to
+// descend with shared latches and latch only the leaf exclusively. If the leaf
+// has to be split or rebalanced, they descend again with exclusive latches and
+// keep only the latches of the nodes that the split or the rebalancing may reach.
+type ConcurrentTree[K, V any] struct {
+	tree *Tree[K, V]
+
+	// Guards the root pointer. It is the latch of the parent of the root.
+	rootLatch sync.RWMutex
+
+	// the number of keys in the tree
+	size atomic.Int64
+}
+
+// newConcurrentTree wraps the empty tree.
+func newConcurrentTree[K, V any](t *Tree[K, V]) (*ConcurrentTree[K, V], error) {
+	if t.counted {
+		return nil, fmt.Errorf("counted mode is not supported by the concurrent tree")
+	}
+	if t.allocator != nil {
+		// the removed nodes might still be latched by the other operations
+		return nil, fmt.Errorf("slab allocator is not supported by the concurrent tree")
+	}
+
+	t.latched = true
+
+	return &ConcurrentTree[K, V]{tree: t}, nil
+}
+
+// Get returns a value by the key. The second return
+// value is a flag that determines if the key was found.
+func (t *ConcurrentTree[K, V]) Get(key K) (V, bool) {
+	leaf, _ := t.descend(&key, false)
+	if leaf == nil {
+		var zero V
+		return zero, false
+	}
+	defer leaf.state.latch.RUnlock()
+
+	position := leaf.keyPosition(key, t.tree.compare)
+	if position == -1 {
+		var zero V
+		return zero, false
+	}
+
+	return leaf.values[position], true
+}
+
+// Put inserts the value into the tree. If the key already exists,
+// it overrides it.
+// Returns true and the previous value if the value has been overridden,
+// otherwise false.
+func (t *ConcurrentTree[K, V]) Put(key K, value V) (V, bool) {
+	leaf, _ := t.descend(&key, true)
+	if leaf != nil {
+		if leaf.keyNum < t.tree.order-1 || leaf.keyPosition(key, t.tree.compare) != -1 {
+			// the leaf is not split
+			oldValue, overridden := t.tree.putIntoLeaf(&path[K, V]{}, leaf, key, value)
+			leaf.state.latch.Unlock()
+			if !overridden {
+				t.size.Add(1)
+			}
+
+			return oldValue, overridden
+		}
+
+		leaf.state.latch.Unlock()
+	}
+
+	latched := t.descendExclusive(key, func(n *node[K, V], root bool) bool {
+		return n.keyNum < t.tree.order-1
+	})
+	defer latched.unlock()
+
+	if len(latched.nodes) == 0 {
+		t.tree.initializeRoot(key, value)
+		t.size.Add(1)
+
+		var zero V
+		return zero, false
+	}
+
+	oldValue, overridden := t.tree.putIntoLeaf(latched.parents(), latched.leaf(), key, value)
+	if !overridden {
+		t.size.Add(1)
+	}
+
+	return oldValue, overridden
+}
+
+// Delete deletes the key from the tree. Returns deleted value and true
+// if the key exists, otherwise nil and false.
+func (t *ConcurrentTree[K, V]) Delete(key K) (V, bool) {
+	leaf, depth := t.descend(&key, true)
+	if leaf == nil {
+		var zero V
+		return zero, false
+	}
+
+	position := leaf.keyPosition(key, t.tree.compare)
+	if position == -1 || t.safeForDelete(leaf, depth == 0) {
+		defer leaf.state.latch.Unlock()
+
+		return t.deleteAt(leaf, position)
+	}
+
+	leaf.state.latch.Unlock()
+
+	return t.deleteExclusive(key)
+}
+
+// deleteExclusive deletes the key from the tree descending with exclusive latches.
+// The tree might have changed since the first attempt, so the leaf might be
+// safe for the deletion or might not contain the key anymore.
+func (t *ConcurrentTree[K, V]) deleteExclusive(key K) (V, bool) {
+	latched := t.descendExclusive(key, t.safeForDelete)
+	defer latched.unlock()
+
+	if len(latched.nodes) == 0 {
+		var zero V
+		return zero, false
+	}
+
+	leaf := latched.leaf()
+	position := leaf.keyPosition(key, t.tree.compare)
+	if position == -1 || len(latched.nodes) == 1 && !latched.rootLatched {
+		// the leaf is not rebalanced
+		return t.deleteAt(leaf, position)
+	}
+
+	// the nodes below the first one on the path might be merged with
+	// or borrow from their siblings, so the siblings are latched as well
+	for i := 1; i < len(latched.nodes); i++ {
+		parent, position := latched.nodes[i-1], latched.positions[i-1]
+		if position > 0 {
+			latched.lock(parent.child(position - 1))
+		}
+		if position < parent.keyNum {
+			latched.lock(parent.child(position + 1))
+		}
+	}
+
+	value, _ := t.tree.deleteAtLeafAndRebalance(latched.parents(), leaf, key)
+	t.size.Add(-1)
+
+	return value, true
+}
+
+// deleteAt deletes the key at the position from the leaf that is not rebalanced
+// after it. Returns the zero value and false if the position is -1.
+func (t *ConcurrentTree[K, V]) deleteAt(leaf *node[K, V], position int) (V, bool) {
+	if position == -1 {
+		var zero V
+		return zero, false
+	}
+
+	value := leaf.values[position]
+	leaf.deleteAt(position, position)
+	t.size.Add(-1)
+
+	return value, true
+}
+
+// safeForDelete returns true if the deletion from the subtree
+// of the node never changes the node itself.
+func (t *ConcurrentTree[K, V]) safeForDelete(n *node[K, V], root bool) bool {
+	if root {
+		// the root is removed or replaced by its only child
+		return n.keyNum > 1
+	}
+
+	return n.keyNum > t.tree.minKeyNum
+}
+
+// Size return the size of the tree.
+func (t *ConcurrentTree[K, V]) Size() int {
+	return int(t.size.Load())
+}
+
+// ForEach traverses tree in ascending key order.
+// See ConcurrentIterator for the guarantees.
+func (t *ConcurrentTree[K, V]) ForEach(action func(key K, value V)) {
+	for it := t.Iterator(); it.HasNext(); {
+		key, value := it.Next()
+		action(key, value)
+	}
+}
+
+// descend descends to the leaf that might contain the key, or to the leftmost
+// leaf if the key is nil, with shared latches and returns the latched leaf and
+// its depth. The leaf is latched exclusively if exclusive is true.
+// Returns nil if the tree is empty.
+func (t *ConcurrentTree[K, V]) descend(key *K, exclusive bool) (*node[K, V], int) {
+	leaf, depth, _, _ := t.descendWithBound(key, exclusive)
+
+	return leaf, depth
+}
+
+// descendWithBound works as descend and also returns the upper bound of the keys
+// in the leaf, and false if the leaf is the rightmost one.
+func (t *ConcurrentTree[K, V]) descendWithBound(key *K, exclusive bool) (*node[K, V], int, K, bool) {
+	var upper K
+	bounded := false
+
+	t.rootLatch.RLock()
+	n := t.tree.root
+	if n == nil {
+		t.rootLatch.RUnlock()
+
+		return nil, 0, upper, false
+	}
+	lockNode(n, exclusive && n.leaf)
+	t.rootLatch.RUnlock()
+
+	depth := 0
+	for !n.leaf {
+		position := 0
+		if key != nil {
+			position = n.childPosition(*key, t.tree.compare)
+		}
+		if position < n.keyNum {
+			upper, bounded = n.keys[position], true
+		}
+
+		child := n.child(position)
+		lockNode(child, exclusive && child.leaf)
+		n.state.latch.RUnlock()
+
+		n = child
+		depth++
+	}
+
+	return n, depth, upper, bounded
+}
+
+// descendExclusive descends to the leaf that might contain the key with
+// exclusive latches. As soon as the node is safe, that is, the operation never
+// changes it, the latches of its ancestors are released.
+// The returned path is empty if the tree is empty.
+func (t *ConcurrentTree[K, V]) descendExclusive(key K, safe func(n *node[K, V], root bool) bool) *latchPath[K, V] {
+	latched := &latchPath[K, V]{rootLatch: &t.rootLatch}
+
+	t.rootLatch.Lock()
+	latched.rootLatched = true
+
+	n := t.tree.root
+	for root := true; n != nil; root = false {
+		n.state.latch.Lock()
+		if safe(n, root) {
+			latched.unlock()
+		}
+
+		if n.leaf {
+			latched.push(n, 0)
+			break
+		}
+
+		position := n.childPosition(key, t.tree.compare)
+		latched.push(n, position)
+
+		n = n.child(position)
+	}
+
+	return latched
+}
+
+// lockNode acquires the exclusive or the shared latch of the node.
+func lockNode[K, V any](n *node[K, V], exclusive bool) {
+	if exclusive {
+		n.state.latch.Lock()
+	} else {
+		n.state.latch.RLock()
+	}
+}
+
+// latchPath holds the exclusive latches acquired by a writer.
+type latchPath[K, V any] struct {
+	rootLatch   *sync.RWMutex
+	rootLatched bool
+
+	// the latched nodes from the top to the leaf
+	// with the positions of the children
+	path[K, V]
+
+	// the latched siblings of the nodes
+	siblings []*node[K, V]
+}
+
+// lock latches the sibling of the node on the path.
+func (p *latchPath[K, V]) lock(sibling *node[K, V]) {
+	sibling.state.latch.Lock()
+	p.siblings = append(p.siblings, sibling)
+}
+
+// leaf returns the last latched node on the path.
+func (p *latchPath[K, V]) leaf() *node[K, V] {
+	return p.nodes[len(p.nodes)-1]
+}
+
+// parents returns the path to the parent of the leaf. It starts at the top
+// latched node, since a split or a rebalancing never goes above it, and the nodes
+// of the concurrent tree are never shared, so they are not copied.
+func (p *latchPath[K, V]) parents() *path[K, V] {
+	last := len(p.nodes) - 1
+
+	return &path[K, V]{p.nodes[:last], p.positions[:last]}
+}
+
+// unlock releases all the latches.
+func (p *latchPath[K, V]) unlock() {
+	for _, n := range p.siblings {
+		n.state.latch.Unlock()
+	}
+	for _, n := range p.nodes {
+		n.state.latch.Unlock()
+	}
+	if p.rootLatched {
+		p.rootLatch.Unlock()
+	}
+
+	p.siblings = p.siblings[:0]
+	p.nodes = p.nodes[:0]
+	p.positions = p.positions[:0]
+	p.rootLatched = false
+}
+
+// Iterator returns a stateful iterator that traverses the tree
+// in ascending key order.
+func (t *ConcurrentTree[K, V]) Iterator() *ConcurrentIterator[K, V] {
+	return &ConcurrentIterator[K, V]{tree: t, inclusive: true}
+}
+
+// Seek returns a stateful iterator that traverses the keys
+// greater than or equal to the given key in ascending key order.
+func (t *ConcurrentTree[K, V]) Seek(key K) *ConcurrentIterator[K, V] {
+	return &ConcurrentIterator[K, V]{tree: t, from: &key, inclusive: true}
+}
+
+// Range returns a stateful iterator that traverses the keys in the range
+// [start, end) in ascending key order. The options change the bounds.
+func (t *ConcurrentTree[K, V]) Range(start, end K, options ...RangeOption) *ConcurrentIterator[K, V] {
+	bounds := &rangeBounds{startInclusive: true}
+	for _, option := range options {
+		option(bounds)
+	}
+
+	return &ConcurrentIterator[K, V]{
+		tree:      t,
+		from:      &start,
+		inclusive: bounds.startInclusive,
+		within: func(key K) bool {
+			c := t.tree.compare(key, end)
+
+			return c < 0 || c == 0 && bounds.endInclusive
+		},
+	}
+}
+
+// ConcurrentIterator traverses the concurrent tree in ascending key order.
+// It copies the entries of one leaf at a time and releases its latch,
+// so it never blocks writers for long. The iteration is weakly consistent:
+// every key is returned at most once and in ascending order, the keys that are
+// present during the whole iteration are always returned, and the keys
+// that are put or deleted during the iteration might be returned or not.
+type ConcurrentIterator[K, V any] struct {
+	tree *ConcurrentTree[K, V]
+
+	// the copied entries of the current leaf
+	keys   []K
+	values []V
+	i      int
+
+	// the key to continue from, nil for the beginning of the tree
+	from      *K
+	inclusive bool
+	done      bool
+
+	// nil if the range is not bounded from above
+	within func(key K) bool
+}
+
+// HasNext returns true if there is a next element to iterate.
+func (it *ConcurrentIterator[K, V]) HasNext() bool {
+	it.fill()
+
+	return it.i < len(it.keys) && (it.within == nil || it.within(it.keys[it.i]))
+}
+
+// Next returns a key and a value at the current position of the iteration
+// and advances the iterator.
+// Caution! Next panics if called on the nil element.
+func (it *ConcurrentIterator[K, V]) Next() (K, V) {
+	if !it.HasNext() {
+		// to sleep well
+		panic("there is no next node")
+	}
+
+	key, value := it.keys[it.i], it.values[it.i]
+	it.i++
+
+	return key, value
+}
+
+// fill copies the entries of the next leaf that has keys after
+// the last returned one if all the copied entries are returned.
+func (it *ConcurrentIterator[K, V]) fill() {
+	for it.i == len(it.keys) && !it.done {
+		it.keys, it.values, it.i = it.keys[:0], it.values[:0], 0
+
+		leaf, _, upper, bounded := it.tree.descendWithBound(it.from, false)
+		if leaf == nil {
+			it.done = true
+
+			return
+		}
+
+		start := 0
+		if it.from != nil {
+			var found bool
+			start, found = leaf.locate(*it.from, it.tree.tree.compare)
+			if found && !it.inclusive {
+				start++
+			}
+		}
+
+		for i := start; i < leaf.keyNum; i++ {
+			it.keys = append(it.keys, leaf.key(i))
+			it.values = append(it.values, leaf.values[i])
+		}
+		leaf.state.latch.RUnlock()
+
+		// all keys in the tree less than the upper bound were
+		// in the leaf, so the iteration continues from it
+		if bounded {
+			it.from, it.inclusive = &upper, true
+		} else {
+			it.done = true
+		}
+	}
+}
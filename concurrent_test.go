@@ -0,0 +1,310 @@
+package bptree
+
+import (
+	"bytes"
+	"cmp"
+	"fmt"
+	"math/rand"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+)
+
+func ExampleNewConcurrent() {
+	tree, _ := NewConcurrent()
+
+	var wg sync.WaitGroup
+	for _, fruit := range []string{"apple", "banana", "cinnamon"} {
+		wg.Add(1)
+		go func(fruit string) {
+			defer wg.Done()
+			tree.Put([]byte(fruit), []byte(fmt.Sprintf("%d", len(fruit))))
+		}(fruit)
+	}
+	wg.Wait()
+
+	tree.ForEach(func(key, value []byte) {
+		fmt.Printf("key = %s, value = %s\n", string(key), string(value))
+	})
+
+	// Output:
+	// key = apple, value = 5
+	// key = banana, value = 6
+	// key = cinnamon, value = 8
+}
+
+func TestNewConcurrentErrors(t *testing.T) {
+	_, err := NewConcurrent(Order(2))
+	if err == nil {
+		t.Fatal("must return an error for the order, but it does not")
+	}
+
+	_, err = NewConcurrent(Counted())
+	if err == nil {
+		t.Fatal("must return an error for the counted mode, but it does not")
+	}
+
+	_, err = NewConcurrent(Comparator(cmp.Compare[int]))
+	if err == nil {
+		t.Fatal("must return an error for the comparator, but it does not")
+	}
+
+	_, err = NewConcurrentTree[int, int](Order(2))
+	if err == nil {
+		t.Fatal("must return an error for the order, but it does not")
+	}
+
+	_, err = NewConcurrentTreeFunc[int, int](nil)
+	if err == nil {
+		t.Fatal("must return an error for the comparator, but it does not")
+	}
+}
+
+func TestConcurrentTreeFunc(t *testing.T) {
+	tree, err := NewConcurrentTreeFunc[string, int](func(x, y string) int {
+		return len(x) - len(y)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tree.Put("ccc", 3)
+	tree.Put("a", 1)
+	tree.Put("bb", 2)
+
+	keys := make([]string, 0)
+	tree.ForEach(func(key string, value int) {
+		keys = append(keys, key)
+	})
+	if !reflect.DeepEqual(keys, []string{"a", "bb", "ccc"}) {
+		t.Fatalf("unexpected keys %v", keys)
+	}
+}
+
+func TestConcurrentPutGetAndDeleteRandomized(t *testing.T) {
+	for order := 3; order <= 7; order++ {
+		tree, _ := NewConcurrentTree[int, int](Order(order))
+		expected := make(map[int]int)
+
+		r := rand.New(rand.NewSource(int64(order)))
+		for i := 0; i < 3000; i++ {
+			key := r.Intn(300)
+			switch r.Intn(3) {
+			case 0:
+				value, ok := tree.Delete(key)
+				expectedValue, expectedOK := expected[key]
+				if value != expectedValue || ok != expectedOK {
+					t.Fatalf("deleted %d, %v, but expected %d, %v", value, ok, expectedValue, expectedOK)
+				}
+				delete(expected, key)
+			case 1:
+				value, ok := tree.Put(key, i)
+				expectedValue, expectedOK := expected[key]
+				if value != expectedValue || ok != expectedOK {
+					t.Fatalf("overridden %d, %v, but expected %d, %v", value, ok, expectedValue, expectedOK)
+				}
+				expected[key] = i
+			default:
+				value, ok := tree.Get(key)
+				expectedValue, expectedOK := expected[key]
+				if value != expectedValue || ok != expectedOK {
+					t.Fatalf("got %d, %v, but expected %d, %v", value, ok, expectedValue, expectedOK)
+				}
+			}
+		}
+
+		assertConcurrentInvariants(t, tree)
+
+		keys := make([]int, 0, len(expected))
+		for key := range expected {
+			keys = append(keys, key)
+		}
+		sort.Ints(keys)
+
+		actual := make([]int, 0)
+		tree.ForEach(func(key, value int) {
+			actual = append(actual, key)
+		})
+		if !reflect.DeepEqual(keys, actual) {
+			t.Fatalf("%v != %v", keys, actual)
+		}
+
+		// delete everything to remove the root
+		for _, key := range keys {
+			tree.Delete(key)
+		}
+		assertConcurrentInvariants(t, tree)
+		if tree.Iterator().HasNext() {
+			t.Fatal("the empty tree must not have keys")
+		}
+	}
+}
+
+func TestConcurrentSeekAndRange(t *testing.T) {
+	tree, _ := NewConcurrentTree[int, int](Order(3))
+	for i := 0; i < 100; i += 2 {
+		tree.Put(i, i)
+	}
+
+	collect := func(it *ConcurrentIterator[int, int]) []int {
+		keys := make([]int, 0)
+		for it.HasNext() {
+			key, _ := it.Next()
+			keys = append(keys, key)
+		}
+
+		return keys
+	}
+
+	if keys := collect(tree.Seek(91)); !reflect.DeepEqual(keys, []int{92, 94, 96, 98}) {
+		t.Fatalf("unexpected keys %v", keys)
+	}
+	if keys := collect(tree.Range(10, 16)); !reflect.DeepEqual(keys, []int{10, 12, 14}) {
+		t.Fatalf("unexpected keys %v", keys)
+	}
+	if keys := collect(tree.Range(10, 16, StartExclusive(), EndInclusive())); !reflect.DeepEqual(keys, []int{12, 14, 16}) {
+		t.Fatalf("unexpected keys %v", keys)
+	}
+
+	it := tree.Seek(100)
+	defer func() {
+		if r := recover(); r == nil {
+			t.Error("Next must panic after the iteration is finished")
+		}
+	}()
+	it.Next()
+}
+
+// TestConcurrentStress runs writers that own disjoint sets of keys and readers
+// that iterate over the tree. The keys that are never touched by the writers
+// must always be seen by the readers. Run it with the race detector.
+func TestConcurrentStress(t *testing.T) {
+	const writers = 8
+	const readers = 4
+	const keyNum = 2000
+	const operations = 3000
+
+	for _, order := range []int{3, 4, 8} {
+		tree, _ := NewConcurrent(Order(order))
+
+		// the keys k with k % (writers+1) == writers are stable
+		stable := make([][]byte, 0)
+		for k := writers; k < keyNum; k += writers + 1 {
+			stable = append(stable, rankKey(k))
+			tree.Put(rankKey(k), rankKey(k))
+		}
+
+		var wg sync.WaitGroup
+		errs := make(chan error, writers+readers)
+
+		for w := 0; w < writers; w++ {
+			wg.Add(1)
+			go func(w int) {
+				defer wg.Done()
+
+				r := rand.New(rand.NewSource(int64(w)))
+				own := make(map[int]bool)
+				for i := 0; i < operations; i++ {
+					k := r.Intn(keyNum/(writers+1))*(writers+1) + w
+					if r.Intn(2) == 0 {
+						_, ok := tree.Put(rankKey(k), rankKey(k))
+						if ok != own[k] {
+							errs <- fmt.Errorf("writer %d: put of %d returned %v", w, k, ok)
+							return
+						}
+						own[k] = true
+					} else {
+						value, ok := tree.Delete(rankKey(k))
+						if ok != own[k] || ok && !bytes.Equal(value, rankKey(k)) {
+							errs <- fmt.Errorf("writer %d: delete of %d returned %v", w, k, ok)
+							return
+						}
+						delete(own, k)
+					}
+
+					_, ok := tree.Get(rankKey(k))
+					if ok != own[k] {
+						errs <- fmt.Errorf("writer %d: get of %d returned %v", w, k, ok)
+						return
+					}
+				}
+			}(w)
+		}
+
+		for reader := 0; reader < readers; reader++ {
+			wg.Add(1)
+			go func(reader int) {
+				defer wg.Done()
+
+				for round := 0; round < 20; round++ {
+					var previous []byte
+					i := 0
+					for it := tree.Iterator(); it.HasNext(); {
+						key, _ := it.Next()
+						if previous != nil && bytes.Compare(previous, key) >= 0 {
+							errs <- fmt.Errorf("reader %d: %v goes after %v", reader, key, previous)
+							return
+						}
+						previous = key
+
+						if i < len(stable) && bytes.Equal(key, stable[i]) {
+							i++
+						}
+					}
+
+					if i != len(stable) {
+						errs <- fmt.Errorf("reader %d: missed the stable key %v", reader, stable[i])
+						return
+					}
+				}
+			}(reader)
+		}
+
+		wg.Wait()
+		close(errs)
+		for err := range errs {
+			t.Fatalf("order %d: %v", order, err)
+		}
+
+		assertConcurrentInvariants(t, tree.ConcurrentTree)
+	}
+}
+
+// assertConcurrentInvariants checks the B+ tree properties of the tree
+// that is not modified concurrently.
+func assertConcurrentInvariants[K, V any](t *testing.T, tree *ConcurrentTree[K, V]) {
+	t.Helper()
+
+	// the concurrent tree keeps the size on its own
+	tree.tree.size = tree.Size()
+	assertInvariants(t, tree.tree)
+}
+
+func TestConcurrentDeleteAfterChanges(t *testing.T) {
+	tree, _ := NewConcurrentTree[int, int](Order(3))
+
+	// the tree has become empty
+	if _, ok := tree.deleteExclusive(1); ok {
+		t.Fatal("must not delete from the empty tree")
+	}
+
+	for i := 0; i < 10; i++ {
+		tree.Put(i, i)
+	}
+
+	// the key has been deleted
+	if _, ok := tree.deleteExclusive(100); ok {
+		t.Fatal("must not delete the non-existent key")
+	}
+
+	// the leaf has got more keys
+	tree.Put(9, 9)
+	tree.Put(10, 10)
+	value, ok := tree.deleteExclusive(10)
+	if !ok || value != 10 {
+		t.Fatalf("expected 10, true, but got %d, %v", value, ok)
+	}
+
+	assertConcurrentInvariants(t, tree)
+}
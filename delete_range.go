@@ -0,0 +1,294 @@
+package bptree
+
+// DeleteRange deletes all keys in the range [start, end) and returns the number
+// of deleted keys. The subtrees that lie entirely within the range are detached
+// at once, and only the nodes along the range boundaries are rebalanced.
+func (t *Tree[K, V]) DeleteRange(start, end K) int {
+	if t.root == nil || !t.less(start, end) {
+		return 0
+	}
+
+	if t.storeErr() != nil || t.log != nil && t.log.write(t.log.appendDeleteRange(nil, start, end)) != nil {
+		return 0
+	}
+
+	// all modified nodes and their ancestors are dirty and
+	// might violate the B+ tree properties
+	dirty := make(map[*node[K, V]]bool)
+	deleted, empty := t.deleteRangeFrom(nil, 0, t.top(), start, end, dirty)
+	if deleted == 0 {
+		return 0
+	}
+
+	t.size -= deleted
+
+	if empty {
+		t.drop(t.root)
+		t.root = nil
+
+		return deleted
+	}
+
+	t.repairRoot(dirty)
+
+	if t.store != nil {
+		// the leaves around the range are found after the rebalancing,
+		// which might have merged the leaf before the range into another one
+		before := t.seekReverse(start, false)
+		before.pin()
+		defer before.unpin()
+
+		t.store.link(before, t.seek(end, true))
+	}
+
+	return deleted
+}
+
+// deleteRangeFrom deletes the keys in the range [start, end) from the subtree
+// at the position of the parent and returns the number of deleted keys and true
+// if the subtree became empty.
+func (t *Tree[K, V]) deleteRangeFrom(parent *node[K, V], position int, n *node[K, V], start, end K, dirty map[*node[K, V]]bool) (int, bool) {
+	deleted := 0
+
+	if n.leaf {
+		keyPosition := 0
+		for keyPosition < n.keyNum {
+			if key := n.key(keyPosition); !t.less(key, start) && t.less(key, end) {
+				n = t.own(parent, position, n)
+				t.freeKey(n.keys[keyPosition])
+				t.freeValue(n.values[keyPosition])
+				n.deleteAt(keyPosition, keyPosition)
+				deleted++
+			} else {
+				keyPosition++
+			}
+		}
+
+		if deleted > 0 {
+			dirty[n] = true
+		}
+
+		return deleted, n.keyNum == 0
+	}
+
+	n = t.own(parent, position, n)
+
+	startPosition := n.childPosition(start, t.compare)
+	endPosition := n.childPosition(end, t.compare)
+
+	// the boundary children are processed from right to left,
+	// so the positions stay valid after the children are removed
+	if endPosition != startPosition {
+		deleted += t.deleteRangeFromChild(n, endPosition, start, end, dirty)
+	}
+
+	// the children between the boundary children are entirely within the range
+	for position := endPosition - 1; position > startPosition; position-- {
+		deleted += t.subtreeKeyNum(n.child(position))
+		t.dropSubtree(n.child(position))
+		n.deleteAt(position-1, position)
+	}
+
+	deleted += t.deleteRangeFromChild(n, startPosition, start, end, dirty)
+
+	if deleted > 0 {
+		dirty[n] = true
+		if t.counted {
+			n.state.count -= deleted
+		}
+	}
+
+	return deleted, n.children[0] == nil
+}
+
+// deleteRangeFromChild deletes the keys in the range [start, end) from the subtree
+// of the child at the position and removes the child if it became empty.
+func (t *Tree[K, V]) deleteRangeFromChild(n *node[K, V], position int, start, end K, dirty map[*node[K, V]]bool) int {
+	deleted, empty := t.deleteRangeFrom(n, position, n.child(position), start, end, dirty)
+	if !empty {
+		return deleted
+	}
+
+	t.drop(n.child(position))
+
+	if n.keyNum == 0 {
+		// the last child is removed
+		n.children[0] = nil
+	} else if position == 0 {
+		n.deleteAt(0, 0)
+	} else {
+		n.deleteAt(position-1, position)
+	}
+
+	return deleted
+}
+
+// subtreeKeyNum returns the number of keys in the subtree of the node.
+func (t *Tree[K, V]) subtreeKeyNum(n *node[K, V]) int {
+	if n.leaf || t.counted {
+		return n.entryNum()
+	}
+
+	keyNum := 0
+	for i := 0; i <= n.keyNum; i++ {
+		keyNum += t.subtreeKeyNum(n.child(i))
+	}
+
+	return keyNum
+}
+
+// dropSubtree releases the nodes of the subtree removed from the tree.
+// Only the file-backed tree and the tree with the slab allocator release
+// the nodes, so the subtree of the other trees is not traversed.
+func (t *Tree[K, V]) dropSubtree(n *node[K, V]) {
+	if t.store == nil && t.allocator == nil {
+		return
+	}
+
+	if n.leaf {
+		for i := 0; i < n.keyNum; i++ {
+			t.freeKey(n.keys[i])
+			t.freeValue(n.values[i])
+		}
+	} else {
+		for i := 0; i <= n.keyNum; i++ {
+			t.dropSubtree(n.child(i))
+		}
+	}
+
+	t.drop(n)
+}
+
+// repairRoot repairs the dirty nodes starting from the root and shrinks the root
+// while it has only one child.
+func (t *Tree[K, V]) repairRoot(dirty map[*node[K, V]]bool) {
+	for !t.root.leaf {
+		if t.root.keyNum == 0 {
+			root := t.root
+			t.root = root.child(0)
+			t.drop(root)
+
+			continue
+		}
+
+		t.repairChildren(t.root, dirty)
+		if t.root.keyNum > 0 {
+			return
+		}
+	}
+}
+
+// repairChildren repairs the dirty children of the internal node, so all of them
+// have the minimum number of keys. The node itself might lose keys while merging
+// its children, and it is repaired by its parent. If the node has only one child,
+// the child can not be repaired until the node gets siblings for it from its parent.
+func (t *Tree[K, V]) repairChildren(n *node[K, V], dirty map[*node[K, V]]bool) {
+	for {
+		position := -1
+		for i := 0; i <= n.keyNum; i++ {
+			if dirty[n.child(i)] {
+				position = i
+				break
+			}
+		}
+
+		if position == -1 {
+			// all children are repaired
+			return
+		}
+
+		child := n.child(position)
+		if !child.leaf && child.keyNum > 0 {
+			t.repairChildren(child, dirty)
+		}
+
+		if child.keyNum >= t.minKeyNum {
+			delete(dirty, child)
+			continue
+		}
+
+		if n.keyNum == 0 {
+			// there is no sibling to merge with or borrow from
+			return
+		}
+
+		leftPosition := position - 1
+		if leftPosition < 0 {
+			leftPosition = position
+		}
+
+		left, right := t.mergeOrRedistribute(n, leftPosition)
+		dirty[left] = true
+		if right != nil {
+			dirty[right] = true
+		}
+	}
+}
+
+// mergeOrRedistribute merges the child at the position with its right sibling
+// if they fit into one node, otherwise it evens out the number of keys between them.
+// Returns the merged node or both of the redistributed nodes.
+func (t *Tree[K, V]) mergeOrRedistribute(n *node[K, V], position int) (*node[K, V], *node[K, V]) {
+	left := t.own(n, position, n.child(position))
+	right := n.child(position + 1)
+
+	if left.leaf {
+		if left.keyNum+right.keyNum <= len(left.keys) {
+			// the values of the merged node are overridden in place afterwards
+			right = t.own(n, position+1, right)
+			left.copyFromRight(right)
+			n.deleteAt(position, position+1)
+			t.drop(right)
+
+			return left, nil
+		}
+
+		right = t.own(n, position+1, right)
+		for left.keyNum < right.keyNum-1 {
+			left.appendValue(right.key(0), right.values[0])
+			right.deleteAt(0, 0)
+		}
+		for left.keyNum > right.keyNum+1 {
+			right.insertValueAt(0, left.key(left.keyNum-1), left.values[left.keyNum-1])
+			left.deleteAt(left.keyNum-1, left.keyNum-1)
+		}
+		n.keys[position] = t.separatorBetween(left, right)
+
+		return left, right
+	}
+
+	if left.keyNum+right.keyNum+1 <= len(left.keys) {
+		// incorporate the split key from the parent for the merging
+		left.keys[left.keyNum] = n.keys[position]
+		left.keyNum++
+
+		left.copyFromRight(right)
+		n.deleteAt(position, position+1)
+		t.drop(right)
+
+		if t.counted {
+			left.recount()
+		}
+
+		return left, nil
+	}
+
+	right = t.own(n, position+1, right)
+	for left.keyNum < right.keyNum-1 {
+		left.appendChild(n.keys[position], right.children[0])
+		n.keys[position] = right.keys[0]
+		right.deleteAt(0, 0)
+	}
+	for left.keyNum > right.keyNum+1 {
+		right.insertChildAt(0, n.keys[position], 0, left.children[left.keyNum])
+		n.keys[position] = left.keys[left.keyNum-1]
+		left.deleteAt(left.keyNum-1, left.keyNum)
+	}
+
+	if t.counted {
+		left.recount()
+		right.recount()
+	}
+
+	return left, right
+}
@@ -0,0 +1,150 @@
+package bptree
+
+import (
+	"fmt"
+	"math/rand"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func ExampleBPTree_DeleteRange() {
+	tree, _ := New()
+
+	tree.Put([]byte("tenant/1/user/1"), []byte("alice"))
+	tree.Put([]byte("tenant/1/user/2"), []byte("bob"))
+	tree.Put([]byte("tenant/2/user/1"), []byte("carol"))
+
+	deleted := tree.DeleteRange([]byte("tenant/1/"), []byte("tenant/2/"))
+	fmt.Printf("deleted = %d\n", deleted)
+
+	tree.ForEach(func(key, value []byte) {
+		fmt.Printf("key = %s, value = %s\n", string(key), string(value))
+	})
+
+	// Output:
+	// deleted = 2
+	// key = tenant/2/user/1, value = carol
+}
+
+func TestDeleteRangeRandomized(t *testing.T) {
+	r := rand.New(rand.NewSource(time.Now().Unix()))
+	size := 300
+
+	for _, counted := range []bool{true, false} {
+		for order := 3; order <= 8; order++ {
+			options := []Option{Order(order)}
+			if counted {
+				options = append(options, Counted())
+			}
+
+			for round := 0; round < 5; round++ {
+				tree, _ := New(options...)
+				expected := make(map[int]bool)
+				for _, k := range r.Perm(size) {
+					if r.Intn(4) > 0 {
+						tree.Put(rankKey(k), rankKey(k))
+						expected[k] = true
+					}
+				}
+
+				for tree.Size() > 0 {
+					start := r.Intn(size + 10)
+					end := start + r.Intn(size/4+1)
+
+					deleted := 0
+					for k := start; k < end; k++ {
+						if expected[k] {
+							delete(expected, k)
+							deleted++
+						}
+					}
+
+					actual := tree.DeleteRange(rankKey(start), rankKey(end))
+					if deleted != actual {
+						t.Fatalf("counted %v, order %d: expected to delete %d keys in [%d, %d), but deleted %d", counted, order, deleted, start, end, actual)
+					}
+
+					assertInvariants(t, tree.Tree)
+					assertKeys(t, tree, expected, size)
+				}
+			}
+		}
+	}
+}
+
+func TestDeleteRangeEverything(t *testing.T) {
+	for order := 3; order <= 8; order++ {
+		tree, _ := New(Order(order), Counted())
+		for k := 0; k < 1000; k++ {
+			tree.Put(rankKey(k), nil)
+		}
+
+		deleted := tree.DeleteRange(rankKey(0), rankKey(1000))
+		if deleted != 1000 {
+			t.Fatalf("order %d: expected to delete 1000 keys, but deleted %d", order, deleted)
+		}
+
+		assertInvariants(t, tree.Tree)
+		if _, _, ok := tree.Min(); ok {
+			t.Fatalf("order %d: the tree must be empty", order)
+		}
+
+		// the tree must stay usable
+		tree.Put(rankKey(1), nil)
+		if tree.Size() != 1 {
+			t.Fatalf("order %d: expected size 1, but got %d", order, tree.Size())
+		}
+	}
+}
+
+func TestDeleteRangeNothing(t *testing.T) {
+	tree, _ := New()
+	if deleted := tree.DeleteRange([]byte{1}, []byte{2}); deleted != 0 {
+		t.Fatalf("expected to delete nothing from the empty tree, but deleted %d", deleted)
+	}
+
+	for k := 0; k < 100; k += 2 {
+		tree.Put(rankKey(k), nil)
+	}
+
+	cases := []struct{ start, end int }{{5, 5}, {10, 1}, {5, 6}, {1000, 2000}}
+	for _, c := range cases {
+		if deleted := tree.DeleteRange(rankKey(c.start), rankKey(c.end)); deleted != 0 {
+			t.Fatalf("expected to delete nothing in [%d, %d), but deleted %d", c.start, c.end, deleted)
+		}
+	}
+
+	if tree.Size() != 50 {
+		t.Fatalf("expected size 50, but got %d", tree.Size())
+	}
+}
+
+// assertKeys checks that the tree contains exactly the expected keys
+// in ascending order in both directions.
+func assertKeys(t *testing.T, tree *BPTree, expected map[int]bool, size int) {
+	t.Helper()
+
+	keys := make([][]byte, 0)
+	for k := 0; k < size; k++ {
+		if expected[k] {
+			keys = append(keys, rankKey(k))
+		}
+	}
+
+	forward := make([][]byte, 0)
+	tree.ForEach(func(key, value []byte) {
+		forward = append(forward, key)
+	})
+	if !reflect.DeepEqual(keys, forward) {
+		t.Fatalf("%v != %v", keys, forward)
+	}
+
+	backward := make([][]byte, 0)
+	tree.ForEachReverse(func(key, value []byte) {
+		backward = append([][]byte{key}, backward...)
+	})
+	if !reflect.DeepEqual(keys, backward) {
+		t.Fatalf("%v != %v", keys, backward)
+	}
+}
@@ -1,45 +1,391 @@
 package bptree
 
+import (
+	"bytes"
+)
+
 // Iterator returns a stateful Iterator for traversing the tree
 // in ascending key order.
-type Iterator struct {
-	next *node
-	i    int
+type Iterator = TreeIterator[[]byte, []byte]
+
+// TreeIterator is a stateful iterator for traversing the tree
+// in ascending key order.
+type TreeIterator[K, V any] struct {
+	cursor *cursor[K, V]
+
+	// within reports if the key is still within the iteration bounds,
+	// nil means that the iteration is not bounded.
+	within func(key K) bool
 }
 
 // Iterator returns a stateful iterator that traverses the tree
 // in ascending key order.
-func (t *BPTree) Iterator() *Iterator {
-	return &Iterator{t.leftmost, 0}
+func (t *Tree[K, V]) Iterator() *TreeIterator[K, V] {
+	return newTreeIterator(t.first(), nil)
+}
+
+// newTreeIterator returns the iterator that starts at the cursor and stops
+// as soon as the key is not within the bounds. The cursor is pinned
+// until the iteration is over or the iterator is closed.
+func newTreeIterator[K, V any](c *cursor[K, V], within func(key K) bool) *TreeIterator[K, V] {
+	c.pin()
+
+	return &TreeIterator[K, V]{c, within}
+}
+
+// Seek returns a stateful iterator that traverses the tree
+// in ascending key order starting from the first key that is greater than
+// or equal to the given key.
+func (t *Tree[K, V]) Seek(key K) *TreeIterator[K, V] {
+	return newTreeIterator(t.seek(key, true), nil)
+}
+
+// RangeOption configures the bounds of the range iteration.
+type RangeOption func(*rangeBounds)
+
+// rangeBounds defines if the start and the end keys of the range
+// are included into the iteration.
+type rangeBounds struct {
+	startInclusive bool
+	endInclusive   bool
+}
+
+// StartExclusive excludes the start key from the range.
+func StartExclusive() RangeOption {
+	return func(b *rangeBounds) {
+		b.startInclusive = false
+	}
+}
+
+// EndInclusive includes the end key into the range.
+func EndInclusive() RangeOption {
+	return func(b *rangeBounds) {
+		b.endInclusive = true
+	}
+}
+
+// Range returns a stateful iterator that traverses the keys
+// from the start key to the end key in ascending order. By default,
+// the start key is included and the end key is excluded: [start, end).
+func (t *Tree[K, V]) Range(start, end K, options ...RangeOption) *TreeIterator[K, V] {
+	bounds := &rangeBounds{startInclusive: true, endInclusive: false}
+	for _, option := range options {
+		option(bounds)
+	}
+
+	c := t.seek(start, bounds.startInclusive)
+
+	within := func(key K) bool {
+		return t.compare(key, end) < 0
+	}
+	if bounds.endInclusive {
+		within = func(key K) bool {
+			return t.compare(key, end) <= 0
+		}
+	}
+
+	return newTreeIterator(c, within)
+}
+
+// PrefixIterator returns a stateful iterator that traverses the keys
+// with the given prefix in ascending key order.
+// The comparator of the tree must place the keys with the prefix right after
+// the prefix itself as bytes.Compare does, otherwise some keys might be skipped.
+func (t *BPTree) PrefixIterator(prefix []byte) *Iterator {
+	c := t.seek(prefix, true)
+
+	within := func(key []byte) bool {
+		return bytes.HasPrefix(key, prefix)
+	}
+
+	return newTreeIterator(c, within)
 }
 
 // HasNext returns true if there is a next element to retrive.
-func (it *Iterator) HasNext() bool {
-	return it.next != nil && it.i < it.next.keyNum
+func (it *TreeIterator[K, V]) HasNext() bool {
+	if !it.cursor.valid() {
+		return false
+	}
+
+	if it.within != nil && !it.within(it.cursor.key()) {
+		// the iteration is over
+		it.cursor.unpin()
+
+		return false
+	}
+
+	return true
 }
 
 // Next returns a key and a value at the current position of the iteration
 // and advances the iterator.
 // Caution! Next panics if called on the nil element.
-func (it *Iterator) Next() ([]byte, []byte) {
+func (it *TreeIterator[K, V]) Next() (K, V) {
 	if !it.HasNext() {
 		// to sleep well
 		panic("there is no next node")
 	}
 
-	key, value := it.next.keys[it.i], it.next.pointers[it.i].asValue()
+	key, value, _ := it.cursor.entry()
+	it.cursor.next()
 
-	it.i++
-	if it.i == it.next.keyNum {
-		nextPointer := it.next.next()
-		if nextPointer != nil {
-			it.next = nextPointer.asNode()
-		} else {
-			it.next = nil
-		}
+	return key, value
+}
+
+// Close stops the iteration before it is over, so HasNext returns false.
+// The iterator of the tree that stores its nodes in a file keeps its current
+// leaf in memory until the iteration is over, so the iterator that is
+// abandoned earlier must be closed. Does nothing if the iteration is over.
+func (it *TreeIterator[K, V]) Close() {
+	it.cursor.close()
+}
+
+// ReverseIterator is a stateful iterator for traversing the tree
+// in descending key order.
+type ReverseIterator = TreeReverseIterator[[]byte, []byte]
+
+// TreeReverseIterator is a stateful iterator for traversing the tree
+// in descending key order.
+type TreeReverseIterator[K, V any] struct {
+	cursor *cursor[K, V]
+}
+
+// ReverseIterator returns a stateful iterator that traverses the tree
+// in descending key order.
+func (t *Tree[K, V]) ReverseIterator() *TreeReverseIterator[K, V] {
+	c := t.last()
+	c.pin()
+
+	return &TreeReverseIterator[K, V]{c}
+}
+
+// HasNext returns true if there is a next element to retrive.
+func (it *TreeReverseIterator[K, V]) HasNext() bool {
+	return it.cursor.valid()
+}
 
-		it.i = 0
+// Next returns a key and a value at the current position of the iteration
+// and moves the iterator backward.
+// Caution! Next panics if called on the nil element.
+func (it *TreeReverseIterator[K, V]) Next() (K, V) {
+	if !it.HasNext() {
+		panic("there is no next node")
 	}
 
+	key, value, _ := it.cursor.entry()
+	it.cursor.previous()
+
 	return key, value
 }
+
+// Close stops the iteration before it is over, so HasNext returns false.
+// See TreeIterator.Close for the details.
+func (it *TreeReverseIterator[K, V]) Close() {
+	it.cursor.close()
+}
+
+// cursor is a position in the tree kept as the path from the root to the leaf,
+// since the leaves are not linked. The positions are the positions of
+// the children in the internal nodes and of the key in the leaf. Moving
+// the cursor to the next or the previous key takes O(1) amortized time.
+// The cursor is invalid if the path is empty.
+type cursor[K, V any] struct {
+	path[K, V]
+
+	// the leaf pinned in memory in the file-backed tree,
+	// nil if the cursor is not pinned
+	pinned *node[K, V]
+
+	// true if the cursor returns the copies of the keys and the values,
+	// since the tree reuses their bytes after they are deleted
+	copyOut bool
+}
+
+// valid returns true if the cursor points to a key.
+func (c *cursor[K, V]) valid() bool {
+	return len(c.nodes) > 0
+}
+
+// leaf returns the leaf at the end of the path.
+func (c *cursor[K, V]) leaf() *node[K, V] {
+	return c.nodes[len(c.nodes)-1]
+}
+
+// key returns the key at the cursor.
+func (c *cursor[K, V]) key() K {
+	return c.leaf().key(c.positions[len(c.positions)-1])
+}
+
+// entry returns the key and the value at the cursor.
+// The last return value is false if the cursor is invalid.
+func (c *cursor[K, V]) entry() (K, V, bool) {
+	if !c.valid() {
+		var key K
+		var value V
+
+		return key, value, false
+	}
+
+	key, value, ok := entryAt(c.leaf(), c.positions[len(c.positions)-1])
+	if c.copyOut {
+		return cloneBytes(key), cloneBytes(value), ok
+	}
+
+	return key, value, ok
+}
+
+// descend pushes the path to the leaf that might contain the key.
+func (c *cursor[K, V]) descend(n *node[K, V], key K, compare func(x, y K) int) {
+	for !n.leaf {
+		position := n.childPosition(key, compare)
+		c.push(n, position)
+
+		n = n.child(position)
+	}
+
+	c.push(n, 0)
+}
+
+// descendFirst pushes the path to the least key of the subtree.
+func (c *cursor[K, V]) descendFirst(n *node[K, V]) {
+	for !n.leaf {
+		c.push(n, 0)
+
+		n = n.child(0)
+	}
+
+	c.push(n, 0)
+}
+
+// descendLast pushes the path to the greatest key of the subtree.
+func (c *cursor[K, V]) descendLast(n *node[K, V]) {
+	for !n.leaf {
+		c.push(n, n.keyNum)
+
+		n = n.child(n.keyNum)
+	}
+
+	c.push(n, n.keyNum-1)
+}
+
+// next moves the cursor to the next key.
+func (c *cursor[K, V]) next() {
+	top := len(c.positions) - 1
+	c.positions[top]++
+	if c.positions[top] == c.leaf().keyNum {
+		c.nextLeaf()
+	}
+}
+
+// previous moves the cursor to the previous key.
+func (c *cursor[K, V]) previous() {
+	top := len(c.positions) - 1
+	c.positions[top]--
+	if c.positions[top] == -1 {
+		c.previousLeaf()
+	}
+}
+
+// nextLeaf moves the cursor to the least key of the next leaf.
+// The cursor becomes invalid after the last leaf.
+func (c *cursor[K, V]) nextLeaf() {
+	// climb up while the nodes are exhausted and descend to the next leaf
+	for {
+		c.pop()
+		if !c.valid() {
+			c.repin()
+
+			return
+		}
+
+		top := len(c.positions) - 1
+		if c.positions[top] < c.nodes[top].keyNum {
+			c.positions[top]++
+			c.descendFirst(c.nodes[top].child(c.positions[top]))
+			if c.leaf().keyNum == 0 {
+				// the leaf that cannot be read is empty, so it is skipped
+				continue
+			}
+			c.repin()
+
+			return
+		}
+	}
+}
+
+// previousLeaf moves the cursor to the greatest key of the previous leaf.
+// The cursor becomes invalid before the first leaf.
+func (c *cursor[K, V]) previousLeaf() {
+	// climb up while the nodes are exhausted and descend to the previous leaf
+	for {
+		c.pop()
+		if !c.valid() {
+			c.repin()
+
+			return
+		}
+
+		top := len(c.positions) - 1
+		if c.positions[top] > 0 {
+			c.positions[top]--
+			c.descendLast(c.nodes[top].child(c.positions[top]))
+			if c.leaf().keyNum == 0 {
+				// the leaf that cannot be read is empty, so it is skipped
+				continue
+			}
+			c.repin()
+
+			return
+		}
+	}
+}
+
+// pin keeps the leaf of the cursor in memory in the file-backed tree, so
+// the cursor stays valid between the operations that evict the nodes.
+// The path to the leaf stays in memory as well, since the nodes are evicted
+// only after their children. The pinned cursor moves the pin to every leaf
+// it moves to, until it becomes invalid or unpin is called.
+func (c *cursor[K, V]) pin() {
+	if !c.valid() {
+		return
+	}
+
+	c.pinned = c.leaf()
+	if c.pinned.frame != nil {
+		c.pinned.frame.pins++
+	}
+}
+
+// unpin releases the pinned leaf.
+func (c *cursor[K, V]) unpin() {
+	if c.pinned == nil {
+		return
+	}
+
+	if c.pinned.frame != nil {
+		c.pinned.frame.pins--
+	}
+	c.pinned = nil
+}
+
+// close unpins the cursor and makes it invalid.
+func (c *cursor[K, V]) close() {
+	c.unpin()
+	c.reset()
+}
+
+// repin moves the pin to the current leaf of the pinned cursor, so the leaf
+// it has left can be evicted, and evicts the cold nodes.
+func (c *cursor[K, V]) repin() {
+	left := c.pinned
+	if left == nil {
+		return
+	}
+
+	c.unpin()
+	c.pin()
+
+	if left.frame != nil {
+		left.frame.store.evict()
+	}
+}
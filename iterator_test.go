@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"reflect"
 	"sort"
+	"strconv"
+	"strings"
 	"testing"
 )
 
@@ -119,3 +121,263 @@ func TestIteratorNextPanicAfterIteration(t *testing.T) {
 	it.Next()
 	it.Next()
 }
+
+func ExampleBPTree_Range() {
+	tree, _ := New()
+
+	tree.Put([]byte("apple"), []byte("sweet"))
+	tree.Put([]byte("banana"), []byte("honey"))
+	tree.Put([]byte("cinnamon"), []byte("savoury"))
+
+	for it := tree.Range([]byte("b"), []byte("cinnamon"), EndInclusive()); it.HasNext(); {
+		key, value := it.Next()
+		fmt.Printf("key = %s, value = %s\n", string(key), string(value))
+	}
+
+	// Output:
+	// key = banana, value = honey
+	// key = cinnamon, value = savoury
+}
+
+func TestSeek(t *testing.T) {
+	for order := 3; order <= 7; order++ {
+		tree, _ := New(Order(order))
+		for _, c := range iteratorCases {
+			tree.Put([]byte{c.key}, []byte(c.value))
+		}
+
+		for seek := byte(0); seek <= 80; seek++ {
+			expected := make([]byte, 0)
+			for _, c := range iteratorCases {
+				if c.key >= seek {
+					expected = append(expected, c.key)
+				}
+			}
+			sort.Slice(expected, func(i, j int) bool {
+				return expected[i] < expected[j]
+			})
+
+			actual := make([]byte, 0)
+			for it := tree.Seek([]byte{seek}); it.HasNext(); {
+				key, _ := it.Next()
+				actual = append(actual, key...)
+			}
+
+			if !reflect.DeepEqual(expected, actual) {
+				t.Fatalf("seek %d, order %d: %v != %v", seek, order, expected, actual)
+			}
+		}
+	}
+}
+
+func TestSeekForEmptyTree(t *testing.T) {
+	tree, _ := New()
+
+	for it := tree.Seek([]byte{1}); it.HasNext(); {
+		t.Fatal("call is not expected")
+	}
+}
+
+func TestRange(t *testing.T) {
+	cases := []struct {
+		name           string
+		options        []RangeOption
+		startInclusive bool
+		endInclusive   bool
+	}{
+		{"[start, end)", nil, true, false},
+		{"[start, end]", []RangeOption{EndInclusive()}, true, true},
+		{"(start, end)", []RangeOption{StartExclusive()}, false, false},
+		{"(start, end]", []RangeOption{StartExclusive(), EndInclusive()}, false, true},
+	}
+
+	for _, c := range cases {
+		for order := 3; order <= 7; order++ {
+			tree, _ := New(Order(order))
+			for _, ic := range iteratorCases {
+				tree.Put([]byte{ic.key}, []byte(ic.value))
+			}
+
+			for start := byte(0); start <= 80; start += 3 {
+				for end := start; end <= 80; end += 5 {
+					expected := make([]byte, 0)
+					for _, ic := range iteratorCases {
+						afterStart := ic.key > start || (c.startInclusive && ic.key == start)
+						beforeEnd := ic.key < end || (c.endInclusive && ic.key == end)
+						if afterStart && beforeEnd {
+							expected = append(expected, ic.key)
+						}
+					}
+					sort.Slice(expected, func(i, j int) bool {
+						return expected[i] < expected[j]
+					})
+
+					actual := make([]byte, 0)
+					for it := tree.Range([]byte{start}, []byte{end}, c.options...); it.HasNext(); {
+						key, _ := it.Next()
+						actual = append(actual, key...)
+					}
+
+					if !reflect.DeepEqual(expected, actual) {
+						t.Fatalf("%s, start %d, end %d, order %d: %v != %v", c.name, start, end, order, expected, actual)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestRangeNextPanicAfterIteration(t *testing.T) {
+	defer func() {
+		if r := recover(); r == nil {
+			t.Error("Next must panic after the range is finished")
+		}
+	}()
+
+	tree, _ := New()
+	tree.Put([]byte{1}, nil)
+	tree.Put([]byte{2}, nil)
+
+	it := tree.Range([]byte{1}, []byte{2})
+	it.Next()
+	it.Next()
+}
+
+func TestReverseIterator(t *testing.T) {
+	for order := 3; order <= 7; order++ {
+		tree, _ := New(Order(order))
+		for _, c := range iteratorCases {
+			tree.Put([]byte{c.key}, []byte(c.value))
+		}
+
+		actual := make([]byte, 0)
+		for it := tree.ReverseIterator(); it.HasNext(); {
+			key, value := it.Next()
+			if string(value) != strconv.Itoa(int(key[0])) {
+				t.Fatalf("unexpected value %s for key %d", value, key[0])
+			}
+			actual = append(actual, key...)
+		}
+
+		expected := make([]byte, 0)
+		for _, c := range iteratorCases {
+			expected = append(expected, c.key)
+		}
+		sort.Slice(expected, func(i, j int) bool {
+			return expected[i] > expected[j]
+		})
+
+		if !reflect.DeepEqual(expected, actual) {
+			t.Fatalf("order %d: %v != %v", order, expected, actual)
+		}
+	}
+}
+
+func TestReverseIteratorForEmptyTree(t *testing.T) {
+	tree, _ := New()
+
+	for it := tree.ReverseIterator(); it.HasNext(); {
+		t.Fatal("call is not expected")
+	}
+}
+
+func TestReverseIteratorAfterDeletion(t *testing.T) {
+	keys := []byte{7, 8, 4, 3, 2, 6, 11, 9, 10, 1, 12, 0, 5}
+
+	tree, _ := New(Order(3))
+	for _, v := range keys {
+		tree.Put([]byte{v}, []byte{v})
+	}
+
+	for i, k := range keys {
+		tree.Delete([]byte{k})
+
+		actual := make([]byte, 0)
+		for it := tree.ReverseIterator(); it.HasNext(); {
+			key, _ := it.Next()
+			actual = append(actual, key...)
+		}
+
+		expected := make([]byte, 0)
+		for j, k := range keys {
+			if j > i {
+				expected = append(expected, k)
+			}
+		}
+		sort.Slice(expected, func(i, j int) bool {
+			return expected[i] > expected[j]
+		})
+
+		if !reflect.DeepEqual(expected, actual) {
+			t.Fatalf("%v != %v for key %d (%d)", expected, actual, k, i)
+		}
+	}
+}
+
+func TestReverseIteratorNextPanicAfterIteration(t *testing.T) {
+	defer func() {
+		if r := recover(); r == nil {
+			t.Error("Next must panic after the iteration is finished")
+		}
+	}()
+
+	tree, _ := New()
+	tree.Put([]byte{1}, nil)
+
+	it := tree.ReverseIterator()
+	it.Next()
+	it.Next()
+}
+
+var prefixCases = []string{
+	"tenant/1/user/1",
+	"tenant/1/user/2",
+	"tenant/1/user/20",
+	"tenant/10/user/1",
+	"tenant/2/user/1",
+	"tenant/2/user/3",
+	"tenant",
+	"tenants",
+	"",
+	"a",
+	"z",
+}
+
+func TestPrefixIterator(t *testing.T) {
+	prefixes := []string{"", "tenant", "tenant/", "tenant/1", "tenant/1/", "tenant/2/user/1", "tenant/3", "b", "zz"}
+
+	for order := 3; order <= 7; order++ {
+		tree, _ := New(Order(order))
+		for _, c := range prefixCases {
+			tree.Put([]byte(c), []byte(c))
+		}
+
+		for _, prefix := range prefixes {
+			expected := make([]string, 0)
+			for _, c := range prefixCases {
+				if strings.HasPrefix(c, prefix) {
+					expected = append(expected, c)
+				}
+			}
+			sort.Strings(expected)
+
+			actual := make([]string, 0)
+			for it := tree.PrefixIterator([]byte(prefix)); it.HasNext(); {
+				key, _ := it.Next()
+				actual = append(actual, string(key))
+			}
+
+			if !reflect.DeepEqual(expected, actual) {
+				t.Fatalf("prefix %q, order %d: %v != %v", prefix, order, expected, actual)
+			}
+		}
+	}
+}
+
+func TestPrefixIteratorForEmptyTree(t *testing.T) {
+	tree, _ := New()
+
+	for it := tree.PrefixIterator([]byte("a")); it.HasNext(); {
+		t.Fatal("call is not expected")
+	}
+}
@@ -0,0 +1,233 @@
+package bptree
+
+import (
+	"cmp"
+	"sync"
+)
+
+// MVCCBPTree is a goroutine-safe multi-version B+ tree
+// with byte-slice keys and values.
+type MVCCBPTree struct {
+	*MVCCTree[[]byte, []byte]
+}
+
+// NewMVCC returns a new instance of the multi-version B+ tree.
+func NewMVCC(options ...Option) (*MVCCBPTree, error) {
+	o, err := newInMemoryOptions(options)
+	if err != nil {
+		return nil, err
+	}
+
+	t, err := newBytesTree(o)
+	if err != nil {
+		return nil, err
+	}
+
+	return &MVCCBPTree{newMVCCTree(t)}, nil
+}
+
+// NewMVCCTree returns a new instance of the multi-version B+ tree
+// with ordered keys of type K and values of type V.
+func NewMVCCTree[K cmp.Ordered, V any](options ...Option) (*MVCCTree[K, V], error) {
+	t, err := NewTree[K, V](options...)
+	if err != nil {
+		return nil, err
+	}
+
+	return newMVCCTree(t), nil
+}
+
+// NewMVCCTreeFunc returns a new instance of the multi-version B+ tree
+// with keys of any type ordered by the given comparator.
+func NewMVCCTreeFunc[K, V any](compare func(x, y K) int, options ...Option) (*MVCCTree[K, V], error) {
+	t, err := NewTreeFunc[K, V](compare, options...)
+	if err != nil {
+		return nil, err
+	}
+
+	return newMVCCTree(t), nil
+}
+
+// MVCCTree is a goroutine-safe multi-version B+ tree with keys of type K
+// and values of type V.
+//
+// Every change of the tree gets the next version, and the state of the tree
+// at any version can be read until it is compacted. The versions are
+// the snapshots of the tree, so they share the unchanged nodes, and every
+// change copies only the nodes on the path from the root to the changed leaf.
+// Writers are serialized, but readers never wait for them.
+type MVCCTree[K, V any] struct {
+	// serializes the writers
+	writeLatch sync.Mutex
+	tree       *Tree[K, V]
+
+	// guards the versions
+	versionsLatch sync.RWMutex
+
+	// the states of the tree in ascending version order,
+	// the first one is the oldest state that is not compacted
+	versions []mvccVersion[K, V]
+}
+
+// mvccVersion is the state of the tree at the version.
+type mvccVersion[K, V any] struct {
+	version  uint64
+	snapshot *TreeSnapshot[K, V]
+}
+
+// newMVCCTree wraps the empty tree, its state is the version 0.
+func newMVCCTree[K, V any](t *Tree[K, V]) *MVCCTree[K, V] {
+	return &MVCCTree[K, V]{
+		tree:     t,
+		versions: []mvccVersion[K, V]{{0, t.snapshot()}},
+	}
+}
+
+// Get returns a value by the key at the latest version. The second return
+// value is a flag that determines if the key was found.
+func (t *MVCCTree[K, V]) Get(key K) (V, bool) {
+	return t.latest().Get(key)
+}
+
+// GetAt returns a value by the key at the given version. The second return
+// value is a flag that determines if the key was found. The versions before
+// the compacted one are not available, and there are no keys in them.
+func (t *MVCCTree[K, V]) GetAt(key K, version uint64) (V, bool) {
+	s := t.at(version)
+	if s == nil {
+		var zero V
+		return zero, false
+	}
+
+	return s.Get(key)
+}
+
+// Put inserts the value into the tree and creates a new version.
+// If the key already exists, it overrides it.
+// Returns true and the previous value if the value has been overridden,
+// otherwise false.
+func (t *MVCCTree[K, V]) Put(key K, value V) (V, bool) {
+	t.writeLatch.Lock()
+	defer t.writeLatch.Unlock()
+
+	oldValue, overridden := t.tree.Put(key, value)
+	t.commit()
+
+	return oldValue, overridden
+}
+
+// Delete deletes the key from the tree and creates a new version if the key
+// exists. Returns deleted value and true if the key exists,
+// otherwise nil and false.
+func (t *MVCCTree[K, V]) Delete(key K) (V, bool) {
+	t.writeLatch.Lock()
+	defer t.writeLatch.Unlock()
+
+	value, deleted := t.tree.Delete(key)
+	if deleted {
+		t.commit()
+	}
+
+	return value, deleted
+}
+
+// commit makes the current state of the tree the next version.
+func (t *MVCCTree[K, V]) commit() {
+	s := t.tree.snapshot()
+
+	t.versionsLatch.Lock()
+	defer t.versionsLatch.Unlock()
+
+	version := t.versions[len(t.versions)-1].version + 1
+	t.versions = append(t.versions, mvccVersion[K, V]{version, s})
+}
+
+// Version returns the latest version of the tree.
+func (t *MVCCTree[K, V]) Version() uint64 {
+	t.versionsLatch.RLock()
+	defer t.versionsLatch.RUnlock()
+
+	return t.versions[len(t.versions)-1].version
+}
+
+// Size return the size of the tree at the latest version.
+func (t *MVCCTree[K, V]) Size() int {
+	return t.latest().Size()
+}
+
+// ForEach traverses the tree at the latest version in ascending key order.
+func (t *MVCCTree[K, V]) ForEach(action func(key K, value V)) {
+	t.latest().ForEach(action)
+}
+
+// Iterator returns a stateful iterator that traverses the tree
+// at the latest version in ascending key order.
+func (t *MVCCTree[K, V]) Iterator() *TreeIterator[K, V] {
+	return t.latest().Iterator()
+}
+
+// IteratorAt returns a stateful iterator that traverses the tree at the given
+// version in ascending key order. The versions before the compacted one
+// are not available, and there are no keys in them.
+func (t *MVCCTree[K, V]) IteratorAt(version uint64) *TreeIterator[K, V] {
+	s := t.at(version)
+	if s == nil {
+		return &TreeIterator[K, V]{&cursor[K, V]{}, nil}
+	}
+
+	return s.Iterator()
+}
+
+// Compact drops the versions before the given one, so the nodes
+// that are not used by the later versions can be garbage collected.
+// The state at the given version remains available.
+func (t *MVCCTree[K, V]) Compact(beforeVersion uint64) {
+	t.versionsLatch.Lock()
+	defer t.versionsLatch.Unlock()
+
+	i := t.search(beforeVersion)
+	if i <= 0 {
+		return
+	}
+
+	// copy the rest, so the dropped versions are not referenced
+	t.versions = append([]mvccVersion[K, V](nil), t.versions[i:]...)
+}
+
+// latest returns the state of the tree at the latest version.
+func (t *MVCCTree[K, V]) latest() *TreeSnapshot[K, V] {
+	t.versionsLatch.RLock()
+	defer t.versionsLatch.RUnlock()
+
+	return t.versions[len(t.versions)-1].snapshot
+}
+
+// at returns the state of the tree at the given version,
+// or nil if it is compacted.
+func (t *MVCCTree[K, V]) at(version uint64) *TreeSnapshot[K, V] {
+	t.versionsLatch.RLock()
+	defer t.versionsLatch.RUnlock()
+
+	i := t.search(version)
+	if i < 0 {
+		return nil
+	}
+
+	return t.versions[i].snapshot
+}
+
+// search returns the position of the latest state at or before
+// the given version, or -1 if there is no such state.
+// The versions of the states are consecutive.
+func (t *MVCCTree[K, V]) search(version uint64) int {
+	first := t.versions[0].version
+	if version < first {
+		return -1
+	}
+
+	if version-first >= uint64(len(t.versions)) {
+		return len(t.versions) - 1
+	}
+
+	return int(version - first)
+}
@@ -0,0 +1,222 @@
+package bptree
+
+import (
+	"cmp"
+	"fmt"
+	"math/rand"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func ExampleNewMVCC() {
+	tree, _ := NewMVCC()
+	tree.Put([]byte("apple"), []byte("sweet"))
+	version := tree.Version()
+
+	tree.Put([]byte("apple"), []byte("sour"))
+	tree.Put([]byte("banana"), []byte("honey"))
+
+	for it := tree.IteratorAt(version); it.HasNext(); {
+		key, value := it.Next()
+		fmt.Printf("at %d: key = %s, value = %s\n", version, string(key), string(value))
+	}
+
+	value, _ := tree.Get([]byte("apple"))
+	fmt.Printf("at %d: apple = %s\n", tree.Version(), string(value))
+
+	// Output:
+	// at 1: key = apple, value = sweet
+	// at 3: apple = sour
+}
+
+func TestNewMVCCErrors(t *testing.T) {
+	_, err := NewMVCC(Order(2))
+	if err == nil {
+		t.Fatal("must return an error for the order, but it does not")
+	}
+
+	_, err = NewMVCC(Comparator(cmp.Compare[int]))
+	if err == nil {
+		t.Fatal("must return an error for the comparator, but it does not")
+	}
+
+	_, err = NewMVCCTree[int, int](Order(2))
+	if err == nil {
+		t.Fatal("must return an error for the order, but it does not")
+	}
+
+	_, err = NewMVCCTreeFunc[int, int](nil)
+	if err == nil {
+		t.Fatal("must return an error for the comparator, but it does not")
+	}
+}
+
+func TestMVCCTreeFunc(t *testing.T) {
+	tree, err := NewMVCCTreeFunc[string, int](func(x, y string) int {
+		return len(x) - len(y)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tree.Put("ccc", 3)
+	tree.Put("a", 1)
+	tree.Put("bb", 2)
+
+	keys := make([]string, 0)
+	tree.ForEach(func(key string, value int) {
+		keys = append(keys, key)
+	})
+	if !reflect.DeepEqual(keys, []string{"a", "bb", "ccc"}) {
+		t.Fatalf("unexpected keys %v", keys)
+	}
+
+	keys = keys[:0]
+	for it := tree.Iterator(); it.HasNext(); {
+		key, _ := it.Next()
+		keys = append(keys, key)
+	}
+	if !reflect.DeepEqual(keys, []string{"a", "bb", "ccc"}) {
+		t.Fatalf("unexpected keys %v", keys)
+	}
+}
+
+func TestMVCCVersionsRandomized(t *testing.T) {
+	for order := 3; order <= 7; order++ {
+		tree, _ := NewMVCCTree[int, int](Order(order))
+
+		// the states of the tree by version
+		states := []map[int]int{{}}
+
+		r := rand.New(rand.NewSource(int64(order)))
+		for i := 0; i < 2000; i++ {
+			key := r.Intn(200)
+			state := states[len(states)-1]
+
+			if r.Intn(3) == 0 {
+				value, ok := tree.Delete(key)
+				expectedValue, expectedOK := state[key]
+				if value != expectedValue || ok != expectedOK {
+					t.Fatalf("deleted %d, %v, but expected %d, %v", value, ok, expectedValue, expectedOK)
+				}
+				if !ok {
+					// nothing is changed, so there is no new version
+					continue
+				}
+
+				state = copyState(state)
+				delete(state, key)
+			} else {
+				tree.Put(key, i)
+				state = copyState(state)
+				state[key] = i
+			}
+
+			states = append(states, state)
+			if tree.Version() != uint64(len(states)-1) {
+				t.Fatalf("expected version %d, but got %d", len(states)-1, tree.Version())
+			}
+		}
+
+		assertSnapshot(t, tree.latest(), states[len(states)-1])
+		if tree.Size() != len(states[len(states)-1]) {
+			t.Fatalf("expected size %d, but got %d", len(states[len(states)-1]), tree.Size())
+		}
+
+		for version := 0; version < len(states); version += 1 + r.Intn(50) {
+			assertMVCCVersion(t, tree, uint64(version), states[version])
+		}
+
+		// the future versions are the latest one
+		assertMVCCVersion(t, tree, uint64(len(states)+10), states[len(states)-1])
+
+		compacted := uint64(len(states) / 2)
+		tree.Compact(compacted)
+		assertMVCCVersion(t, tree, compacted-1, map[int]int{})
+		assertMVCCVersion(t, tree, compacted, states[compacted])
+		assertMVCCVersion(t, tree, compacted+1, states[compacted+1])
+
+		// compacting the earlier version does not change anything
+		tree.Compact(compacted - 1)
+		assertMVCCVersion(t, tree, compacted, states[compacted])
+	}
+}
+
+func TestMVCCReadersDoNotWaitForWriters(t *testing.T) {
+	tree, _ := NewMVCC(Order(4))
+	for k := 0; k < 500; k++ {
+		tree.Put(rankKey(k), rankKey(k))
+	}
+	version := tree.Version()
+
+	var wg sync.WaitGroup
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+
+			for k := w; k < 500; k += 4 {
+				tree.Delete(rankKey(k))
+				tree.Put(rankKey(k+1000), rankKey(k))
+			}
+		}(w)
+	}
+
+	for reader := 0; reader < 4; reader++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			i := 0
+			for it := tree.IteratorAt(version); it.HasNext(); i++ {
+				key, _ := it.Next()
+				if !reflect.DeepEqual(key, rankKey(i)) {
+					t.Errorf("expected %v, but got %v", rankKey(i), key)
+				}
+				if _, ok := tree.GetAt(key, version); !ok {
+					t.Errorf("%v is not found at version %d", key, version)
+				}
+			}
+			tree.Get(rankKey(i))
+		}()
+	}
+
+	wg.Wait()
+
+	if tree.Version() != version+1000 || tree.Size() != 500 {
+		t.Fatalf("expected version %d and size 500, but got %d and %d", version+1000, tree.Version(), tree.Size())
+	}
+	assertInvariants(t, tree.tree)
+}
+
+// assertMVCCVersion checks the state of the tree at the version.
+func assertMVCCVersion(t *testing.T, tree *MVCCTree[int, int], version uint64, expected map[int]int) {
+	t.Helper()
+
+	actual := make(map[int]int)
+	for it := tree.IteratorAt(version); it.HasNext(); {
+		key, value := it.Next()
+		actual[key] = value
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("version %d: %v != %v", version, actual, expected)
+	}
+
+	for key := 0; key < 200; key++ {
+		value, ok := tree.GetAt(key, version)
+		expectedValue, expectedOK := expected[key]
+		if value != expectedValue || ok != expectedOK {
+			t.Fatalf("version %d: got %d, %v for %d, but expected %d, %v", version, value, ok, key, expectedValue, expectedOK)
+		}
+	}
+}
+
+func copyState(state map[int]int) map[int]int {
+	c := make(map[int]int, len(state))
+	for key, value := range state {
+		c[key] = value
+	}
+
+	return c
+}
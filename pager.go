@@ -0,0 +1,228 @@
+package bptree
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+)
+
+// The file of the file-backed tree is a sequence of pages of the same size,
+// numbered from 0. The page 0 is the header of the file, and the other pages
+// keep the nodes or are free. All numbers are little-endian.
+//
+// The header page:
+//
+//	offset  size  field
+//	0       8     magic "bptree\x00\x00"
+//	8       4     format version, 1
+//	12      4     page size
+//	16      4     order
+//	20      1     1 for the tree in the counted mode
+//	24      8     root page, 0 for the empty tree
+//	32      8     number of keys
+//	40      8     number of pages
+//	48      8     first free page, 0 if there are no free pages
+//
+// The node page:
+//
+//	offset  size  field
+//	0       1     page type, 1 for the leaf and 2 for the internal node
+//	1       1     1 if the children of the internal node are leaves
+//	4       4     number of keys
+//	8       8     next-leaf link, the page of the next leaf, 0 for the last leaf
+//	16      8     number of keys in the subtree of the internal node in the counted mode
+//	24      8     first overflow page, 0 if the node fits into the page
+//	32      4     payload length
+//	36      4     CRC-32 (IEEE) of the payload
+//	40            payload
+//
+// The payload of the leaf is its keys, each followed by its value, and
+// the payload of the internal node is its keys followed by the 8-byte pages
+// of its children. The keys and the values are prefixed by their uvarint length.
+// If the payload does not fit into the page, the rest of it is stored in
+// the chain of the overflow pages.
+//
+// The overflow page and the free page:
+//
+//	offset  size  field
+//	0       1     page type, 3 for the overflow page and 4 for the free page
+//	8       8     next page of the chain, 0 for the last page
+//	16            the rest of the payload of the overflow page
+const (
+	fileVersion = 1
+
+	defaultPageSize = 4096
+	minPageSize     = 128
+
+	headerSize         = 56
+	nodeHeaderSize     = 40
+	overflowHeaderSize = 16
+)
+
+// fileMagic identifies the file of the file-backed tree.
+var fileMagic = []byte("bptree\x00\x00")
+
+// the types of the pages
+const (
+	leafPage byte = iota + 1
+	internalPage
+	overflowPage
+	freePage
+)
+
+// PageSize sets the size of the pages of the file-backed tree in bytes.
+// The minimum size is 128 bytes, and the default one is 4096 bytes.
+// The page size of the existing file is read from it, and Open returns
+// an error if the option does not match it.
+func PageSize(size int) Option {
+	return func(o *options) error {
+		if size < minPageSize {
+			return fmt.Errorf("page size must be >= %d", minPageSize)
+		}
+
+		o.pageSize, o.pageSizeSet = size, true
+
+		return nil
+	}
+}
+
+// header is the content of the header page of the file.
+type header struct {
+	pageSize int
+	order    int
+	counted  bool
+	root     uint64
+	size     int
+}
+
+// pager reads and writes the pages of the file and allocates them.
+type pager struct {
+	file     *os.File
+	pageSize int
+
+	// the number of pages in the file, including the header page
+	pageNum uint64
+
+	// the released pages, which are reused before the file grows
+	free []uint64
+}
+
+// openPager opens the pages of the file. It returns the header of the file,
+// or nil if the file is empty.
+func openPager(file *os.File, pageSize int) (*pager, *header, error) {
+	p := &pager{file: file, pageSize: pageSize, pageNum: 1}
+
+	b := make([]byte, headerSize)
+	n, err := file.ReadAt(b, 0)
+	if n == 0 && err == io.EOF {
+		return p, nil, nil
+	}
+
+	if n < headerSize || !bytes.Equal(b[0:8], fileMagic) {
+		return nil, nil, fmt.Errorf("file is not a B+ tree")
+	}
+	if version := binary.LittleEndian.Uint32(b[8:]); version != fileVersion {
+		return nil, nil, fmt.Errorf("unsupported file version %d", version)
+	}
+
+	p.pageSize = int(binary.LittleEndian.Uint32(b[12:]))
+	p.pageNum = binary.LittleEndian.Uint64(b[40:])
+
+	h := &header{
+		pageSize: p.pageSize,
+		order:    int(binary.LittleEndian.Uint32(b[16:])),
+		counted:  b[20] == 1,
+		root:     binary.LittleEndian.Uint64(b[24:]),
+		size:     int(binary.LittleEndian.Uint64(b[32:])),
+	}
+
+	// the free pages are chained
+	link := make([]byte, overflowHeaderSize)
+	for page := binary.LittleEndian.Uint64(b[48:]); page != 0; page = binary.LittleEndian.Uint64(link[8:]) {
+		err := p.read(page, link)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		p.free = append(p.free, page)
+	}
+
+	return p, h, nil
+}
+
+// read reads the beginning of the page into the buffer.
+func (p *pager) read(page uint64, b []byte) error {
+	_, err := p.file.ReadAt(b, int64(page)*int64(p.pageSize))
+
+	return err
+}
+
+// write writes the buffer to the beginning of the page.
+func (p *pager) write(page uint64, b []byte) error {
+	_, err := p.file.WriteAt(b, int64(page)*int64(p.pageSize))
+
+	return err
+}
+
+// allocate returns a free page, or a new one at the end of the file.
+func (p *pager) allocate() uint64 {
+	if last := len(p.free) - 1; last >= 0 {
+		page := p.free[last]
+		p.free = p.free[:last]
+
+		return page
+	}
+
+	p.pageNum++
+
+	return p.pageNum - 1
+}
+
+// release frees the page, so it can be allocated again.
+func (p *pager) release(page uint64) {
+	p.free = append(p.free, page)
+}
+
+// close chains the free pages, writes the header and closes the file.
+// Returns the first error.
+func (p *pager) close(h header) error {
+	var err error
+	b := make([]byte, p.pageSize)
+
+	next := uint64(0)
+	for _, page := range p.free {
+		b[0] = freePage
+		binary.LittleEndian.PutUint64(b[8:], next)
+		if err == nil {
+			err = p.write(page, b[:overflowHeaderSize])
+		}
+
+		next = page
+	}
+
+	copy(b, fileMagic)
+	binary.LittleEndian.PutUint32(b[8:], fileVersion)
+	binary.LittleEndian.PutUint32(b[12:], uint32(p.pageSize))
+	binary.LittleEndian.PutUint32(b[16:], uint32(h.order))
+	if h.counted {
+		b[20] = 1
+	}
+	binary.LittleEndian.PutUint64(b[24:], h.root)
+	binary.LittleEndian.PutUint64(b[32:], uint64(h.size))
+	binary.LittleEndian.PutUint64(b[40:], p.pageNum)
+	binary.LittleEndian.PutUint64(b[48:], next)
+
+	if err == nil {
+		err = p.write(0, b)
+	}
+	if err == nil {
+		err = p.file.Sync()
+	}
+	if closeErr := p.file.Close(); err == nil {
+		err = closeErr
+	}
+
+	return err
+}
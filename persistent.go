@@ -0,0 +1,89 @@
+package bptree
+
+// With returns a new version of the tree with the value put by the key.
+// The tree itself is not changed. The versions share the unchanged nodes,
+// so only the nodes on the path from the root to the changed leaf are copied.
+func (t *BPTree) With(key, value []byte) (*BPTree, error) {
+	v, err := t.Tree.With(key, value)
+	if err != nil {
+		return nil, err
+	}
+
+	return &BPTree{v}, nil
+}
+
+// Without returns a new version of the tree without the key.
+// The tree itself is not changed. The versions share the unchanged nodes,
+// so only the nodes on the path from the root to the changed leaf are copied.
+func (t *BPTree) Without(key []byte) (*BPTree, error) {
+	v, err := t.Tree.Without(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return &BPTree{v}, nil
+}
+
+// With returns a new version of the tree with the value put by the key.
+// The tree itself is not changed. The versions share the unchanged nodes,
+// so only the nodes on the path from the root to the changed leaf are copied.
+//
+// All versions remain fully functional and can be changed in place
+// independently of each other, including from different goroutines.
+// But With must not be called concurrently with other calls on the same
+// version, since it marks the nodes of the version as shared.
+// The versions are not supported by the tree that stores its nodes in a file,
+// like the file-backed tree, so it returns an error.
+func (t *Tree[K, V]) With(key K, value V) (*Tree[K, V], error) {
+	v, err := t.version()
+	if err != nil {
+		return nil, err
+	}
+
+	v.Put(key, value)
+
+	return v, nil
+}
+
+// Without returns a new version of the tree without the key.
+// The tree itself is not changed. See With for the details.
+func (t *Tree[K, V]) Without(key K) (*Tree[K, V], error) {
+	v, err := t.version()
+	if err != nil {
+		return nil, err
+	}
+
+	v.Delete(key)
+
+	return v, nil
+}
+
+// version returns a new tree that shares all nodes with the tree.
+// Both trees get new generations, so neither of them considers the shared
+// nodes as its own, and they copy the nodes before they modify them.
+func (t *Tree[K, V]) version() (*Tree[K, V], error) {
+	err := t.inMemory("versions")
+	if err != nil {
+		return nil, err
+	}
+
+	t.generation = generations.Add(1)
+
+	v := *t
+	v.generation = generations.Add(1)
+
+	// only the tree itself is logged, not its versions
+	v.log = nil
+
+	// the versions might be changed from different goroutines, so they
+	// share neither the path of the current operation nor the allocator
+	v.path = path[K, V]{}
+	if t.allocator != nil {
+		v.allocator = newAllocator[K, V](t.order)
+		if t.allocator.arena != nil {
+			v.allocator.arena = &arena{}
+		}
+	}
+
+	return &v, nil
+}
@@ -0,0 +1,158 @@
+package bptree
+
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+	"testing"
+)
+
+func ExampleBPTree_With() {
+	empty, _ := New()
+
+	fruits, _ := empty.With([]byte("apple"), []byte("sweet"))
+	more, _ := fruits.With([]byte("banana"), []byte("honey"))
+	less, _ := more.Without([]byte("apple"))
+
+	for _, version := range []*BPTree{empty, fruits, more, less} {
+		fmt.Printf("%d:", version.Size())
+		version.ForEach(func(key, value []byte) {
+			fmt.Printf(" %s=%s", string(key), string(value))
+		})
+		fmt.Println()
+	}
+
+	// Output:
+	// 0:
+	// 1: apple=sweet
+	// 2: apple=sweet banana=honey
+	// 1: banana=honey
+}
+
+func TestWithAndWithoutRandomized(t *testing.T) {
+	for order := 3; order <= 7; order++ {
+		for _, options := range [][]Option{{Order(order)}, {Order(order), Counted()}} {
+			base, _ := NewTree[int, int](options...)
+
+			versions := []*Tree[int, int]{base}
+			states := []map[int]int{{}}
+
+			r := rand.New(rand.NewSource(int64(order)))
+			for i := 0; i < 2000; i++ {
+				// any version, not only the latest one, can be changed
+				from := r.Intn(len(versions))
+				state := make(map[int]int)
+				for key, value := range states[from] {
+					state[key] = value
+				}
+
+				key := r.Intn(200)
+				var version *Tree[int, int]
+				if r.Intn(3) == 0 {
+					version, _ = versions[from].Without(key)
+					delete(state, key)
+				} else {
+					version, _ = versions[from].With(key, i)
+					state[key] = i
+				}
+
+				versions = append(versions, version)
+				states = append(states, state)
+			}
+
+			for i, version := range versions {
+				assertInvariants(t, version)
+				snapshot, _ := version.Snapshot()
+				assertSnapshot(t, snapshot, states[i])
+			}
+		}
+	}
+}
+
+func TestWithAndChangesInPlace(t *testing.T) {
+	tree, _ := NewTree[int, int](Order(3))
+	for i := 0; i < 100; i++ {
+		tree.Put(i, i)
+	}
+
+	version, _ := tree.With(100, 100)
+
+	// both trees are changed in place and do not affect each other
+	for i := 0; i < 100; i += 2 {
+		tree.Put(i, -i)
+		version.Delete(i)
+	}
+	tree.DeleteRange(50, 70)
+	version.DeleteRange(10, 30)
+
+	expected := make(map[int]int)
+	for i := 0; i < 100; i++ {
+		if i < 50 || i >= 70 {
+			expected[i] = i
+			if i%2 == 0 {
+				expected[i] = -i
+			}
+		}
+	}
+	assertInvariants(t, tree)
+	snapshot, _ := tree.Snapshot()
+	assertSnapshot(t, snapshot, expected)
+
+	expected = make(map[int]int)
+	for i := 1; i <= 100; i += 2 {
+		if i < 10 || i >= 30 {
+			expected[i] = i
+		}
+	}
+	expected[100] = 100
+	assertInvariants(t, version)
+	snapshot, _ = version.Snapshot()
+	assertSnapshot(t, snapshot, expected)
+}
+
+func TestVersionsChangedConcurrently(t *testing.T) {
+	base, _ := NewTree[int, int](Order(4))
+	for i := 0; i < 1000; i++ {
+		base.Put(i, i)
+	}
+
+	versions := make([]*Tree[int, int], 4)
+	for v := range versions {
+		versions[v], _ = base.Without(v)
+	}
+
+	var wg sync.WaitGroup
+	for v, version := range versions {
+		wg.Add(1)
+		go func(v int, version *Tree[int, int]) {
+			defer wg.Done()
+
+			for i := v; i < 1000; i += 3 {
+				version.Put(i, -i)
+				version.Delete(i + 1)
+			}
+		}(v, version)
+	}
+
+	for reader := 0; reader < 2; reader++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			i := 0
+			base.ForEach(func(key, value int) {
+				if key != i || value != i {
+					t.Errorf("expected %d, but got %d: %d", i, key, value)
+				}
+				i++
+			})
+		}()
+	}
+
+	wg.Wait()
+
+	assertInvariants(t, base)
+	for _, version := range versions {
+		assertInvariants(t, version)
+	}
+}
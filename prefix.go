@@ -0,0 +1,149 @@
+package bptree
+
+import "bytes"
+
+// PrefixCompression enables the prefix-compressed layout of the leaves,
+// in which every leaf stores the common prefix of its keys once and the keys
+// keep only their suffixes. It saves the memory taken by the keys that share
+// long prefixes, but the keys returned by the tree are rebuilt from the prefix
+// and the suffix, so each of them is allocated. Supported only by the trees
+// with byte-slice keys in the bytes.Compare order.
+func PrefixCompression() Option {
+	return func(o *options) error {
+		o.prefixCompression = true
+
+		return nil
+	}
+}
+
+// compress moves the common prefix of the keys of the leaf to its prefix,
+// so the keys keep only their suffixes. The suffixes are copied, so the memory
+// taken by the longer keys is released. It does nothing unless the tree
+// compresses the prefixes.
+func (t *Tree[K, V]) compress(n *node[K, V]) {
+	if !t.prefixCompression || n.keyNum == 0 {
+		return
+	}
+
+	// the keys are sorted, so the first and the last keys
+	// share the prefix of all of them
+	first, last := bytesOf(n.keys[0]), bytesOf(n.keys[n.keyNum-1])
+	length := commonPrefixLength(first, last)
+	if length == 0 {
+		return
+	}
+
+	n.state.prefix = join(n.state.prefix, first[:length])
+	for i := 0; i < n.keyNum; i++ {
+		n.keys[i] = keyOf[K](bytes.Clone(bytesOf(n.keys[i])[length:]))
+	}
+}
+
+// key returns the key at the position of the node, rebuilt from the prefix
+// of the leaf if it is compressed.
+func (n *node[K, V]) key(position int) K {
+	prefix := n.prefix()
+	if len(prefix) == 0 {
+		return n.keys[position]
+	}
+
+	return keyOf[K](join(prefix, bytesOf(n.keys[position])))
+}
+
+// locate returns the position of the first key of the leaf that is greater
+// than or equal to the key, and true if it is equal to the key.
+func (n *node[K, V]) locate(key K, compare func(x, y K) int) (int, bool) {
+	prefix := n.prefix()
+	if len(prefix) == 0 {
+		return search(n.keys[:n.keyNum], key, compare)
+	}
+
+	k := bytesOf(key)
+	if !bytes.HasPrefix(k, prefix) {
+		// all keys of the leaf are either greater or less than the key
+		if bytes.Compare(k, prefix) < 0 {
+			return 0, false
+		}
+
+		return n.keyNum, false
+	}
+
+	return search(n.keys[:n.keyNum], keyOf[K](k[len(prefix):]), compare)
+}
+
+// locateBytes is locate of the leaf with byte-slice keys in the bytes.Compare order.
+func locateBytes(n *node[[]byte, []byte], key []byte) (int, bool) {
+	prefix := n.prefix()
+	if !bytes.HasPrefix(key, prefix) {
+		// all keys of the leaf are either greater or less than the key
+		if bytes.Compare(key, prefix) < 0 {
+			return 0, false
+		}
+
+		return n.keyNum, false
+	}
+
+	return searchBytes(n.keys[:n.keyNum], key[len(prefix):])
+}
+
+// suffix returns the suffix of the key to store in the leaf. If the key does not
+// start with the prefix of the leaf, the prefix is shortened. The suffix is copied
+// unless the leaf is not compressed, so the key must be copied by the caller then.
+func (n *node[K, V]) suffix(key K) K {
+	if len(n.prefix()) == 0 {
+		return key
+	}
+
+	k := bytesOf(key)
+	if length := commonPrefixLength(k, n.state.prefix); length < len(n.state.prefix) {
+		// the rest of the prefix is moved back to the keys
+		rest := n.state.prefix[length:]
+		for i := 0; i < n.keyNum; i++ {
+			n.keys[i] = keyOf[K](join(rest, bytesOf(n.keys[i])))
+		}
+
+		n.state.prefix = n.state.prefix[:length]
+	}
+
+	return keyOf[K](bytes.Clone(k[len(n.state.prefix):]))
+}
+
+// prefix returns the common prefix of the keys of the compressed leaf,
+// empty if the leaf is not compressed.
+func (n *node[K, V]) prefix() []byte {
+	if n.state == nil {
+		return nil
+	}
+
+	return n.state.prefix
+}
+
+// bytesOf returns the key of the tree with byte-slice keys as it is.
+func bytesOf[K any](key K) []byte {
+	return any(key).([]byte)
+}
+
+// keyOf returns the byte slice as the key of the tree with byte-slice keys.
+func keyOf[K any](b []byte) K {
+	return any(b).(K)
+}
+
+// join returns the new slice with the prefix followed by the suffix.
+func join(prefix, suffix []byte) []byte {
+	b := make([]byte, len(prefix)+len(suffix))
+	copy(b[copy(b, prefix):], suffix)
+
+	return b
+}
+
+// commonPrefixLength returns the length of the common prefix of the slices.
+func commonPrefixLength(x, y []byte) int {
+	length := min(len(x), len(y))
+	for i := 0; i < length; i++ {
+		if x[i] != y[i] {
+			return i
+		}
+	}
+
+	return length
+}
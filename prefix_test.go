@@ -0,0 +1,248 @@
+package bptree
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func ExamplePrefixCompression() {
+	tree, _ := New(PrefixCompression())
+
+	tree.Put([]byte("org/123/project/456/task/1"), []byte("open"))
+	tree.Put([]byte("org/123/project/456/task/2"), []byte("done"))
+
+	for it := tree.Iterator(); it.HasNext(); {
+		key, value := it.Next()
+		fmt.Printf("%s = %s\n", key, value)
+	}
+	// Output:
+	// org/123/project/456/task/1 = open
+	// org/123/project/456/task/2 = done
+}
+
+func TestPrefixCompressionErrors(t *testing.T) {
+	if _, err := NewTree[int, int](PrefixCompression()); err == nil {
+		t.Fatal("expected the error for the integer keys")
+	}
+	if _, err := New(PrefixCompression(), Comparator(bytes.Compare)); err == nil {
+		t.Fatal("expected the error for the comparator")
+	}
+	if _, err := NewBLink(PrefixCompression()); err == nil {
+		t.Fatal("expected the error for the B-link tree")
+	}
+}
+
+func TestPrefixCompressionRandomized(t *testing.T) {
+	for order := 3; order <= 7; order++ {
+		for _, counted := range []bool{false, true} {
+			options := []Option{Order(order), PrefixCompression()}
+			if counted {
+				options = append(options, Counted())
+			}
+
+			tree, err := New(options...)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			expected := make(map[string][]byte)
+			var snapshot *Snapshot
+			var snapshotted map[string][]byte
+
+			r := rand.New(rand.NewSource(int64(order)))
+			for i := 0; i < 5000; i++ {
+				organization, item := r.Intn(4), r.Intn(300)
+				switch r.Intn(10) {
+				case 0:
+					end := item + r.Intn(30)
+					tree.DeleteRange(prefixKey(organization, item), prefixKey(organization, end))
+					for key := range expected {
+						if bytes.Compare([]byte(key), prefixKey(organization, item)) >= 0 && bytes.Compare([]byte(key), prefixKey(organization, end)) < 0 {
+							delete(expected, key)
+						}
+					}
+				case 1, 2, 3:
+					tree.Delete(prefixKey(organization, item))
+					delete(expected, string(prefixKey(organization, item)))
+				default:
+					tree.Put(prefixKey(organization, item), rankKey(i))
+					expected[string(prefixKey(organization, item))] = rankKey(i)
+				}
+
+				if i == 2500 {
+					snapshot, _ = tree.Snapshot()
+					snapshotted = clone(expected)
+				}
+			}
+
+			assertContents(t, tree, expected)
+			assertCompressed(t, tree.Tree)
+
+			for key, value := range snapshotted {
+				if actual, ok := snapshot.Get([]byte(key)); !ok || !bytes.Equal(actual, value) {
+					t.Fatalf("expected %v for %s in the snapshot, but got %v", value, key, actual)
+				}
+			}
+
+			for _, key := range [][]byte{[]byte("a"), []byte("org/1/a"), []byte("org/1/z"), []byte("z")} {
+				if _, ok := tree.Get(key); ok {
+					t.Fatalf("unexpected key %s", key)
+				}
+			}
+
+			rank := 0
+			for it := tree.Iterator(); it.HasNext(); rank++ {
+				key, _ := it.Next()
+				if actual, found := tree.Rank(key); actual != rank || !found {
+					t.Fatalf("expected the rank %d of %s, but got %d", rank, key, actual)
+				}
+			}
+		}
+	}
+}
+
+func TestPrefixCompressionShortensPrefix(t *testing.T) {
+	tree, _ := New(Order(5), PrefixCompression())
+	for i := 0; i < 10; i++ {
+		tree.Put(prefixKey(1, i), nil)
+	}
+
+	// the keys without the prefix of the leaves move it back to their keys
+	expected := make(map[string][]byte)
+	for i := 0; i < 10; i++ {
+		expected[string(prefixKey(1, i))] = nil
+	}
+	for _, key := range []string{"org/1/project/7/item/", "org/1/project/7", "org/1", "org/1/project/7/item/99"} {
+		tree.Put([]byte(key), nil)
+		expected[key] = nil
+
+		assertContents(t, tree, expected)
+	}
+}
+
+func TestPrefixCompressionBulkLoadAndSerialize(t *testing.T) {
+	keys := make([][]byte, 0)
+	for i := 0; i < 1000; i++ {
+		keys = append(keys, prefixKey(i/100, i))
+	}
+
+	expected := make(map[string][]byte)
+	tree, _ := New(PrefixCompression())
+	for _, key := range keys {
+		tree.Put(key, key)
+		expected[string(key)] = key
+	}
+
+	var b bytes.Buffer
+	if _, err := tree.WriteTo(&b); err != nil {
+		t.Fatal(err)
+	}
+
+	restored, _ := New(Order(7), PrefixCompression())
+	if _, err := restored.ReadFrom(&b); err != nil {
+		t.Fatal(err)
+	}
+
+	assertContents(t, restored, expected)
+	assertCompressed(t, restored.Tree)
+}
+
+func TestPrefixCompressionFileBacked(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tree")
+
+	tree, err := Open(path, Order(4), PageSize(128), CacheSize(4), PrefixCompression())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := make(map[string][]byte)
+	for i := 0; i < 500; i++ {
+		tree.Put(prefixKey(i%3, i), rankKey(i))
+		expected[string(prefixKey(i%3, i))] = rankKey(i)
+	}
+	for i := 0; i < 500; i += 3 {
+		tree.Delete(prefixKey(i%3, i))
+		delete(expected, string(prefixKey(i%3, i)))
+	}
+
+	assertFile(t, tree, expected)
+	if err := tree.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	tree, err = Open(path, PrefixCompression())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tree.Close()
+
+	assertFile(t, tree, expected)
+	assertCompressed(t, tree.Tree)
+}
+
+func TestPrefixCompressionConcurrent(t *testing.T) {
+	tree, _ := NewConcurrent(Order(4), PrefixCompression())
+	for i := 0; i < 100; i++ {
+		tree.Put(prefixKey(0, i), rankKey(i))
+	}
+
+	it := tree.Range(prefixKey(0, 10), prefixKey(0, 13))
+	for _, i := range []int{10, 11, 12} {
+		key, value := it.Next()
+		if !bytes.Equal(key, prefixKey(0, i)) || !bytes.Equal(value, rankKey(i)) {
+			t.Fatalf("expected %s, but got %s", prefixKey(0, i), key)
+		}
+	}
+	if it.HasNext() {
+		t.Fatal("expected the end of the range")
+	}
+}
+
+// assertCompressed checks that the leaves of the tree store their prefixes.
+func assertCompressed(t *testing.T, tree *Tree[[]byte, []byte]) {
+	t.Helper()
+
+	for c := tree.first(); c.valid(); c.nextLeaf() {
+		if c.leaf().keyNum > 1 && len(c.leaf().prefix()) == 0 {
+			t.Fatalf("the leaf with the key %s is not compressed", c.key())
+		}
+	}
+}
+
+// prefixKey returns the key of the item in the organization,
+// so the keys of the same organization share the long prefix.
+func prefixKey(organization, item int) []byte {
+	return []byte(fmt.Sprintf("org/%d/project/%d/item/%05d", organization, organization*7, item))
+}
+
+func BenchmarkPrefixCompressionMemory(b *testing.B) {
+	for _, compressed := range []bool{false, true} {
+		b.Run(fmt.Sprintf("compressed=%t", compressed), func(b *testing.B) {
+			options := []Option{Order(64)}
+			if compressed {
+				options = append(options, PrefixCompression())
+			}
+
+			var before, after runtime.MemStats
+			for n := 0; n < b.N; n++ {
+				BenchmarkTree = nil
+				runtime.GC()
+				runtime.ReadMemStats(&before)
+
+				BenchmarkTree, _ = New(options...)
+				for k := 0; k < benchmarkKeyNum; k++ {
+					BenchmarkTree.Put(prefixKey(k%10, k), nil)
+				}
+
+				runtime.GC()
+				runtime.ReadMemStats(&after)
+			}
+
+			b.ReportMetric(float64(after.HeapAlloc-before.HeapAlloc)/benchmarkKeyNum, "heap-bytes/key")
+		})
+	}
+}
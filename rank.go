@@ -0,0 +1,101 @@
+package bptree
+
+// Rank returns the number of keys less than the given key, which is
+// the position of the key in ascending key order. The second return value
+// is a flag that determines if the key was found.
+// Takes O(log n) time in the counted mode and O(n) otherwise.
+func (t *Tree[K, V]) Rank(key K) (int, bool) {
+	if t.root == nil {
+		return 0, false
+	}
+
+	if !t.counted {
+		c := t.first()
+		c.pin()
+		defer c.unpin()
+
+		rank := 0
+		for ; c.valid(); c.next() {
+			if cmp := t.compare(c.key(), key); cmp >= 0 {
+				return rank, cmp == 0
+			}
+
+			rank++
+		}
+
+		return rank, false
+	}
+
+	rank := 0
+	current := t.top()
+	for !current.leaf {
+		position := current.childPosition(key, t.compare)
+		for i := 0; i < position; i++ {
+			// skip the subtrees with the keys less than the given key
+			rank += current.child(i).entryNum()
+		}
+
+		current = current.child(position)
+	}
+
+	position, found := current.locate(key, t.compare)
+
+	return rank + position, found
+}
+
+// At returns the key and the value at the given position in ascending key order.
+// The last return value is false if the position is out of range.
+// Takes O(log n) time in the counted mode and O(n) otherwise.
+func (t *Tree[K, V]) At(i int) (K, V, bool) {
+	if i < 0 || i >= t.size {
+		return entryAt[K, V](nil, 0)
+	}
+
+	if !t.counted {
+		c := t.first()
+		c.pin()
+		defer c.unpin()
+
+		for c.valid() && i >= c.leaf().keyNum {
+			// skip the whole leaf
+			i -= c.leaf().keyNum
+			c.nextLeaf()
+		}
+		if !c.valid() {
+			// the leaves that cannot be read are empty
+			return entryAt[K, V](nil, 0)
+		}
+
+		return t.copyOut(entryAt(c.leaf(), i))
+	}
+
+	current := t.top()
+	for !current.leaf {
+		position := 0
+		for position < current.keyNum && i >= current.child(position).entryNum() {
+			i -= current.child(position).entryNum()
+			position++
+		}
+
+		current = current.child(position)
+	}
+	if i >= current.keyNum {
+		// the leaves that cannot be read are empty
+		return entryAt[K, V](nil, 0)
+	}
+
+	return t.copyOut(entryAt(current, i))
+}
+
+// CountRange returns the number of keys in the range [start, end).
+// Takes O(log n) time in the counted mode and O(n) otherwise.
+func (t *Tree[K, V]) CountRange(start, end K) int {
+	if !t.less(start, end) {
+		return 0
+	}
+
+	startRank, _ := t.Rank(start)
+	endRank, _ := t.Rank(end)
+
+	return endRank - startRank
+}
@@ -0,0 +1,164 @@
+package bptree
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+func ExampleBPTree_Rank() {
+	tree, _ := New(Counted())
+
+	tree.Put([]byte("apple"), []byte("sweet"))
+	tree.Put([]byte("banana"), []byte("honey"))
+	tree.Put([]byte("cinnamon"), []byte("savoury"))
+
+	rank, ok := tree.Rank([]byte("banana"))
+	fmt.Printf("rank = %d, ok = %v\n", rank, ok)
+
+	key, value, _ := tree.At(2)
+	fmt.Printf("key = %s, value = %s\n", string(key), string(value))
+
+	fmt.Printf("count = %d\n", tree.CountRange([]byte("a"), []byte("c")))
+
+	// Output:
+	// rank = 1, ok = true
+	// key = cinnamon, value = savoury
+	// count = 2
+}
+
+func TestRankAndAt(t *testing.T) {
+	r := rand.New(rand.NewSource(time.Now().Unix()))
+	size := 1000
+
+	for _, counted := range []bool{true, false} {
+		for order := 3; order <= 7; order++ {
+			options := []Option{Order(order)}
+			if counted {
+				options = append(options, Counted())
+			}
+			tree, _ := New(options...)
+
+			// only even keys are put to test absent keys
+			for _, k := range r.Perm(size) {
+				tree.Put(rankKey(2*k), rankKey(2*k))
+			}
+			// delete every third key to check rebalancing
+			for _, k := range r.Perm(size) {
+				if k%3 == 0 {
+					tree.Delete(rankKey(2 * k))
+				}
+			}
+			assertCounts(t, tree.Tree, tree.root)
+
+			expected := make([]int, 0)
+			for k := 0; k < size; k++ {
+				if k%3 != 0 {
+					expected = append(expected, 2*k)
+				}
+			}
+
+			for i, k := range expected {
+				rank, ok := tree.Rank(rankKey(k))
+				if !ok || rank != i {
+					t.Fatalf("counted %v, order %d: expected rank %d for key %d, but got %d (%v)", counted, order, i, k, rank, ok)
+				}
+
+				rank, ok = tree.Rank(rankKey(k + 1))
+				if ok || rank != i+1 {
+					t.Fatalf("counted %v, order %d: expected rank %d for absent key %d, but got %d (%v)", counted, order, i+1, k+1, rank, ok)
+				}
+
+				key, _, ok := tree.At(i)
+				if !ok || binary.BigEndian.Uint32(key) != uint32(k) {
+					t.Fatalf("counted %v, order %d: expected key %d at %d, but got %v (%v)", counted, order, k, i, key, ok)
+				}
+			}
+
+			for _, i := range []int{-1, len(expected), len(expected) + 1} {
+				if _, _, ok := tree.At(i); ok {
+					t.Fatalf("counted %v, order %d: expected no key at %d", counted, order, i)
+				}
+			}
+
+			for i := 0; i < 100; i++ {
+				start, end := r.Intn(2*size+2), r.Intn(2*size+2)
+
+				count := 0
+				for _, k := range expected {
+					if k >= start && k < end {
+						count++
+					}
+				}
+
+				actual := tree.CountRange(rankKey(start), rankKey(end))
+				if count != actual {
+					t.Fatalf("counted %v, order %d: expected %d keys in [%d, %d), but got %d", counted, order, count, start, end, actual)
+				}
+			}
+		}
+	}
+}
+
+func TestRankForEmptyTree(t *testing.T) {
+	tree, _ := New(Counted())
+
+	rank, ok := tree.Rank([]byte{1})
+	if rank != 0 || ok {
+		t.Fatalf("expected rank 0 and false for the empty tree, but got %d and %v", rank, ok)
+	}
+
+	if _, _, ok := tree.At(0); ok {
+		t.Fatal("expected no key at 0 for the empty tree")
+	}
+}
+
+func TestCountedDeleteAll(t *testing.T) {
+	keys := []byte{7, 8, 4, 3, 2, 6, 11, 9, 10, 1, 12, 0, 5}
+
+	tree, _ := New(Order(3), Counted())
+	for _, k := range keys {
+		tree.Put([]byte{k}, []byte{k})
+	}
+
+	for i, k := range keys {
+		tree.Delete([]byte{k})
+		if tree.root != nil {
+			assertCounts(t, tree.Tree, tree.root)
+		}
+
+		if tree.root != nil && tree.root.entryNum() != len(keys)-i-1 {
+			t.Fatalf("expected %d keys in the root, but got %d", len(keys)-i-1, tree.root.entryNum())
+		}
+	}
+}
+
+func rankKey(k int) []byte {
+	key := make([]byte, 4)
+	binary.BigEndian.PutUint32(key, uint32(k))
+
+	return key
+}
+
+// assertCounts checks that the internal nodes keep the correct number
+// of keys in their subtrees and returns the number of keys in the subtree.
+func assertCounts[K, V any](t *testing.T, tree *Tree[K, V], n *node[K, V]) int {
+	t.Helper()
+
+	if n.leaf {
+		return n.keyNum
+	}
+
+	count := 0
+	for i := 0; i <= n.keyNum; i++ {
+		count += assertCounts(t, tree, n.child(i))
+	}
+
+	if tree.counted && count != n.state.count {
+		t.Fatalf("expected %d keys in the subtree, but the node keeps %d", count, n.state.count)
+	}
+
+	return count
+}
@@ -0,0 +1,314 @@
+package bptree
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+)
+
+// The serialized tree is a sequence of its key-value pairs in ascending key
+// order. All numbers are little-endian.
+//
+//	offset  size  field
+//	0       8     magic "bptree\x00\x01"
+//	8       4     format version, 1
+//	12      8     number of keys
+//	20            keys, each followed by its value
+//	              CRC-32 (IEEE) of all preceding bytes, 4 bytes
+//
+// The keys and the values are prefixed by their uvarint length.
+const (
+	serializedVersion    = 1
+	serializedHeaderSize = 20
+	serializedFooterSize = 4
+
+	// the byte slices up to this length are read at once,
+	// the longer ones grow while they are read, so a corrupted
+	// length does not allocate the memory for it
+	maxPreallocatedSize = 64 << 10
+
+	// the short byte slices are carved out of the chunks of this size,
+	// which is much faster than allocating them one by one
+	chunkSize = 64 << 10
+
+	// the read bytes are checksummed in the batches of this size,
+	// since the checksum of many short slices is slow
+	checksumBatchSize = 32 << 10
+)
+
+// serializedMagic identifies the serialized tree. It differs from fileMagic,
+// so the file of the file-backed tree is not read as the serialized tree.
+var serializedMagic = []byte("bptree\x00\x01")
+
+// WriteTo writes the keys and the values of the tree to w
+// in the versioned and checksummed binary format, which ReadFrom reads.
+// Returns the number of bytes written and the first error.
+func (t *BPTree) WriteTo(w io.Writer) (int64, error) {
+	c := &countingWriter{w: w}
+	e := &encoder{w: bufio.NewWriter(c)}
+
+	header := make([]byte, serializedHeaderSize)
+	copy(header, serializedMagic)
+	binary.LittleEndian.PutUint32(header[8:], serializedVersion)
+	binary.LittleEndian.PutUint64(header[12:], uint64(t.size))
+	e.write(header)
+
+	var entry []byte
+	t.ForEach(func(key, value []byte) {
+		entry = appendBytes(appendBytes(entry[:0], key), value)
+		e.write(entry)
+	})
+
+	e.write(binary.LittleEndian.AppendUint32(nil, e.checksum))
+	if e.err == nil {
+		e.err = e.w.Flush()
+	}
+
+	return c.n, e.err
+}
+
+// ReadFrom replaces the contents of the tree with the tree written
+// by WriteTo to r, keeping the order and the other options of the tree.
+// The tree is built bottom-up, like by NewFromSorted, and it is not changed
+// if the data is malformed. If r does not implement io.ByteReader,
+// ReadFrom might read from it past the end of the serialized tree.
+// Returns the number of bytes read and the first error.
+//
+// Only the in-memory tree can be read, not the file-backed or logged one,
+// and the zero BPTree is initialized with the default options.
+func (t *BPTree) ReadFrom(r io.Reader) (int64, error) {
+	fresh, n, err := t.decode(r)
+	if err != nil {
+		return n, err
+	}
+
+	t.root, t.size = fresh.root, fresh.size
+
+	return n, nil
+}
+
+// decode reads the serialized tree into a new tree with the same options.
+func (t *BPTree) decode(r io.Reader) (*Tree[[]byte, []byte], int64, error) {
+	if t.Tree == nil {
+		tree, _ := New()
+		t.Tree = tree.Tree
+	}
+
+	if t.store != nil || t.log != nil {
+		return nil, 0, fmt.Errorf("only the in-memory tree can be read")
+	}
+
+	br, ok := r.(byteReader)
+	if !ok {
+		br = bufio.NewReader(r)
+	}
+	d := &decoder{r: br}
+
+	header := make([]byte, serializedHeaderSize)
+	if err := d.read(header); err != nil {
+		return nil, d.n, err
+	}
+	if !bytes.Equal(header[0:8], serializedMagic) {
+		return nil, d.n, fmt.Errorf("data is not a serialized B+ tree")
+	}
+	if version := binary.LittleEndian.Uint32(header[8:]); version != serializedVersion {
+		return nil, d.n, fmt.Errorf("unsupported format version %d", version)
+	}
+	d.remaining = binary.LittleEndian.Uint64(header[12:])
+
+	// the decoded keys are copies already
+	fresh := *t.Tree
+	fresh.root, fresh.size, fresh.copyKey = nil, 0, nil
+
+	err := fresh.load(d, 1)
+	if err == nil {
+		err = d.err
+	}
+	if err != nil {
+		return nil, d.n, err
+	}
+
+	checksum := d.sum()
+	footer := make([]byte, serializedFooterSize)
+	if err := d.read(footer); err != nil {
+		return nil, d.n, err
+	}
+	if binary.LittleEndian.Uint32(footer) != checksum {
+		return nil, d.n, fmt.Errorf("checksum mismatch")
+	}
+
+	return &fresh, d.n, nil
+}
+
+// MarshalBinary returns the tree in the binary format of WriteTo.
+func (t *BPTree) MarshalBinary() ([]byte, error) {
+	var b bytes.Buffer
+	_, err := t.WriteTo(&b)
+
+	return b.Bytes(), err
+}
+
+// UnmarshalBinary replaces the contents of the tree with the tree
+// in the binary format of WriteTo. See ReadFrom for the details.
+func (t *BPTree) UnmarshalBinary(data []byte) error {
+	r := bytes.NewReader(data)
+	fresh, _, err := t.decode(r)
+	if err != nil {
+		return err
+	}
+	if r.Len() > 0 {
+		return fmt.Errorf("unexpected %d bytes after the serialized tree", r.Len())
+	}
+
+	t.root, t.size = fresh.root, fresh.size
+
+	return nil
+}
+
+// countingWriter counts the bytes written to the writer.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(b []byte) (int, error) {
+	n, err := c.w.Write(b)
+	c.n += int64(n)
+
+	return n, err
+}
+
+// encoder writes the serialized tree and computes its checksum.
+// It keeps the first error and does not write after it.
+type encoder struct {
+	w        *bufio.Writer
+	checksum uint32
+	err      error
+}
+
+func (e *encoder) write(b []byte) {
+	if e.err != nil {
+		return
+	}
+
+	e.checksum = crc32.Update(e.checksum, crc32.IEEETable, b)
+	_, e.err = e.w.Write(b)
+}
+
+// byteReader reads the serialized tree byte by byte and in chunks.
+type byteReader interface {
+	io.Reader
+	io.ByteReader
+}
+
+// decoder reads the serialized tree and computes its checksum.
+// It iterates over the key-value pairs for the bulk load and
+// keeps the first error, which stops the iteration.
+type decoder struct {
+	r byteReader
+	n int64
+
+	// the checksum of the bytes read before the pending ones
+	checksum uint32
+	pending  []byte
+
+	// the rest of the chunk for the short byte slices
+	chunk []byte
+
+	// the number of key-value pairs left to read
+	remaining uint64
+
+	key, value []byte
+	err        error
+}
+
+// read reads exactly len(b) bytes.
+func (d *decoder) read(b []byte) error {
+	n, err := io.ReadFull(d.r, b)
+	d.n += int64(n)
+	d.hash(b[:n])
+	if err != nil {
+		return fmt.Errorf("failed to read the serialized tree: %w", err)
+	}
+
+	return nil
+}
+
+// readBytes reads the byte slice prefixed by its length.
+func (d *decoder) readBytes() ([]byte, error) {
+	size, err := binary.ReadUvarint(d.r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the serialized tree: %w", err)
+	}
+
+	length := len(d.pending)
+	d.pending = binary.AppendUvarint(d.pending, size)
+	d.n += int64(len(d.pending) - length)
+
+	if size <= maxPreallocatedSize {
+		if int(size) > len(d.chunk) {
+			d.chunk = make([]byte, max(chunkSize, int(size)))
+		}
+
+		// the capacity is limited, so appending to the slice does not
+		// overwrite the next one
+		b := d.chunk[:size:size]
+		d.chunk = d.chunk[size:]
+
+		return b, d.read(b)
+	}
+
+	var b bytes.Buffer
+	n, err := io.CopyN(&b, d.r, int64(size))
+	d.n += n
+	d.hash(b.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the serialized tree: %w", err)
+	}
+
+	return b.Bytes(), nil
+}
+
+// hash adds the read bytes to the checksum.
+func (d *decoder) hash(b []byte) {
+	if len(b) >= checksumBatchSize {
+		d.checksum = crc32.Update(d.sum(), crc32.IEEETable, b)
+
+		return
+	}
+
+	d.pending = append(d.pending, b...)
+	if len(d.pending) >= checksumBatchSize {
+		d.sum()
+	}
+}
+
+// sum returns the checksum of all bytes read.
+func (d *decoder) sum() uint32 {
+	d.checksum = crc32.Update(d.checksum, crc32.IEEETable, d.pending)
+	d.pending = d.pending[:0]
+
+	return d.checksum
+}
+
+func (d *decoder) HasNext() bool {
+	if d.remaining == 0 || d.err != nil {
+		return false
+	}
+
+	d.key, d.err = d.readBytes()
+	if d.err == nil {
+		d.value, d.err = d.readBytes()
+	}
+
+	return d.err == nil
+}
+
+func (d *decoder) Next() ([]byte, []byte) {
+	d.remaining--
+
+	return d.key, d.value
+}
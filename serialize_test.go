@@ -0,0 +1,220 @@
+package bptree
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+func ExampleBPTree_WriteTo() {
+	tree, _ := New()
+	tree.Put([]byte("apple"), []byte("sweet"))
+	tree.Put([]byte("banana"), []byte("honey"))
+
+	var b bytes.Buffer
+	tree.WriteTo(&b)
+
+	restored, _ := New(Order(64))
+	restored.ReadFrom(&b)
+	restored.ForEach(func(key, value []byte) {
+		fmt.Printf("%s = %s\n", key, value)
+	})
+	// Output:
+	// apple = sweet
+	// banana = honey
+}
+
+func TestSerializeRoundTrip(t *testing.T) {
+	for _, size := range []int{0, 1, 10, 10000} {
+		for order := 3; order <= 7; order++ {
+			tree, _ := New(Order(order))
+			expected := make(map[string][]byte)
+			for i := 0; i < size; i++ {
+				tree.Put(rankKey(i), rankKey(i*2))
+				expected[string(rankKey(i))] = rankKey(i * 2)
+			}
+
+			var b bytes.Buffer
+			written, err := tree.WriteTo(&b)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if written != int64(b.Len()) {
+				t.Fatalf("expected %d bytes written, but got %d", b.Len(), written)
+			}
+
+			// the order of the restored tree is its own
+			restored, _ := New(Order(10-order), Counted())
+			restored.Put([]byte("replaced"), nil)
+
+			read, err := restored.ReadFrom(&b)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if read != written {
+				t.Fatalf("expected %d bytes read, but got %d", written, read)
+			}
+
+			assertContents(t, restored, expected)
+			if restored.order != 10-order {
+				t.Fatalf("expected order %d, but got %d", 10-order, restored.order)
+			}
+		}
+	}
+}
+
+func TestSerializeLargeValues(t *testing.T) {
+	tree, _ := New()
+	expected := make(map[string][]byte)
+	for i := 0; i < 3; i++ {
+		value := bytes.Repeat([]byte{byte(i)}, maxPreallocatedSize*(i+1))
+		tree.Put(rankKey(i), value)
+		expected[string(rankKey(i))] = value
+	}
+
+	data, err := tree.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the zero tree is initialized with the default options
+	var restored BPTree
+	if err := restored.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	assertContents(t, &restored, expected)
+
+	// the reader without ReadByte is buffered
+	restored = BPTree{}
+	if _, err := restored.ReadFrom(struct{ io.Reader }{bytes.NewReader(data)}); err != nil {
+		t.Fatal(err)
+	}
+	assertContents(t, &restored, expected)
+}
+
+func TestSerializeMalformedData(t *testing.T) {
+	tree, _ := New(Order(3))
+	for i := 0; i < 100; i++ {
+		tree.Put(rankKey(i), rankKey(i))
+	}
+
+	data, _ := tree.MarshalBinary()
+
+	restored, _ := New()
+	restored.Put([]byte("kept"), []byte("value"))
+	expected := map[string][]byte{"kept": []byte("value")}
+
+	// the malformed data does not change the tree
+	for size := 0; size < len(data); size++ {
+		if err := restored.UnmarshalBinary(data[:size]); err == nil {
+			t.Fatalf("expected the error for %d bytes", size)
+		}
+	}
+	for i := range data {
+		corrupted := bytes.Clone(data)
+		corrupted[i] ^= 0x10
+		if err := restored.UnmarshalBinary(corrupted); err == nil {
+			t.Fatalf("expected the error for the corrupted byte %d", i)
+		}
+	}
+	assertContents(t, restored, expected)
+
+	// the large value is cut short
+	large, _ := New()
+	large.Put([]byte("large"), bytes.Repeat([]byte{1}, maxPreallocatedSize+1))
+	largeData, _ := large.MarshalBinary()
+	if err := restored.UnmarshalBinary(largeData[:len(largeData)-100]); err == nil {
+		t.Fatal("expected the error for the large value")
+	}
+
+	if err := restored.UnmarshalBinary(append(data, 0)); err == nil {
+		t.Fatal("expected the error for the trailing data")
+	}
+
+	// the keys are not sorted, but the checksum is valid
+	data = append(bytes.Clone(serializedMagic), 1, 0, 0, 0, 2, 0, 0, 0, 0, 0, 0, 0)
+	data = appendBytes(appendBytes(data, []byte("b")), nil)
+	data = appendBytes(appendBytes(data, []byte("a")), nil)
+	data = binary.LittleEndian.AppendUint32(data, crc32.ChecksumIEEE(data))
+	if err := restored.UnmarshalBinary(data); err == nil {
+		t.Fatal("expected the error")
+	}
+
+	assertContents(t, restored, expected)
+}
+
+func TestSerializeHeaderErrors(t *testing.T) {
+	tree, _ := New()
+	data, _ := tree.MarshalBinary()
+
+	notTree := bytes.Clone(data)
+	copy(notTree, fileMagic)
+	if _, err := tree.ReadFrom(bytes.NewReader(notTree)); err == nil || err.Error() != "data is not a serialized B+ tree" {
+		t.Fatalf("expected the magic error, but got %v", err)
+	}
+
+	unsupported := bytes.Clone(data)
+	unsupported[8] = 2
+	if err := tree.UnmarshalBinary(unsupported); err == nil || err.Error() != "unsupported format version 2" {
+		t.Fatalf("expected the version error, but got %v", err)
+	}
+
+	file, _ := Open(filepath.Join(t.TempDir(), "tree"))
+	defer file.Close()
+	if err := file.UnmarshalBinary(data); err == nil {
+		t.Fatal("expected the error for the file-backed tree")
+	}
+}
+
+type failingWriter struct {
+	limit int
+}
+
+func (w *failingWriter) Write(b []byte) (int, error) {
+	if len(b) > w.limit {
+		return w.limit, fmt.Errorf("no space left")
+	}
+
+	w.limit -= len(b)
+
+	return len(b), nil
+}
+
+func TestSerializeWriteErrors(t *testing.T) {
+	tree, _ := New()
+	for i := 0; i < 10000; i++ {
+		tree.Put(rankKey(i), rankKey(i))
+	}
+
+	for _, limit := range []int{0, 100, 5000} {
+		n, err := tree.WriteTo(&failingWriter{limit})
+		if err == nil {
+			t.Fatal("expected the write error")
+		}
+		if n != int64(limit) {
+			t.Fatalf("expected %d bytes written, but got %d", limit, n)
+		}
+	}
+}
+
+func BenchmarkReadFrom(b *testing.B) {
+	tree, _ := New(Order(128))
+	for k := 0; k < benchmarkKeyNum; k++ {
+		key := strconv.Itoa(k)
+		tree.Put([]byte(key), []byte(key))
+	}
+
+	data, _ := tree.MarshalBinary()
+	b.SetBytes(int64(len(data)))
+	b.ResetTimer()
+
+	for n := 0; n < b.N; n++ {
+		restored, _ := New(Order(128))
+		restored.UnmarshalBinary(data)
+	}
+}
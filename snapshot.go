@@ -0,0 +1,132 @@
+package bptree
+
+import "sync/atomic"
+
+// Snapshot is a read-only point-in-time view of the tree.
+type Snapshot = TreeSnapshot[[]byte, []byte]
+
+// TreeSnapshot is a read-only point-in-time view of the tree. It shares
+// the nodes with the tree, and the tree copies the shared nodes before
+// it modifies them, so the snapshot is not affected by the later changes.
+// The snapshot can be read concurrently with the changes of the tree.
+type TreeSnapshot[K, V any] struct {
+	root    *node[K, V]
+	size    int
+	compare func(x, y K) int
+}
+
+// generations is the source of the unique generations of the trees,
+// so the trees that share nodes never consider the nodes of each other
+// as their own.
+var generations atomic.Uint64
+
+// Snapshot returns a read-only point-in-time view of the tree in O(1) time.
+// After it, Put and Delete copy the nodes on the path from the root
+// to the modified leaf instead of modifying them in place.
+// Snapshots are not supported by the tree that stores its nodes in a file,
+// like the file-backed tree, so it returns an error.
+func (t *Tree[K, V]) Snapshot() (*TreeSnapshot[K, V], error) {
+	err := t.inMemory("snapshots")
+	if err != nil {
+		return nil, err
+	}
+
+	return t.snapshot(), nil
+}
+
+// snapshot returns a read-only point-in-time view of the tree
+// that keeps its nodes in memory.
+func (t *Tree[K, V]) snapshot() *TreeSnapshot[K, V] {
+	t.generation = generations.Add(1)
+
+	return &TreeSnapshot[K, V]{t.root, t.size, t.compare}
+}
+
+// Get returns a value by the key. The second return
+// value is a flag that determines if the key was found.
+func (s *TreeSnapshot[K, V]) Get(key K) (V, bool) {
+	var zero V
+	if s.root == nil {
+		return zero, false
+	}
+
+	n := s.root
+	for !n.leaf {
+		n = n.child(n.childPosition(key, s.compare))
+	}
+
+	position := n.keyPosition(key, s.compare)
+	if position == -1 {
+		return zero, false
+	}
+
+	return n.values[position], true
+}
+
+// Size return the size of the snapshot.
+func (s *TreeSnapshot[K, V]) Size() int {
+	return s.size
+}
+
+// ForEach traverses the snapshot in ascending key order.
+func (s *TreeSnapshot[K, V]) ForEach(action func(key K, value V)) {
+	for it := s.Iterator(); it.HasNext(); {
+		key, value := it.Next()
+		action(key, value)
+	}
+}
+
+// Iterator returns a stateful iterator that traverses the snapshot
+// in ascending key order.
+func (s *TreeSnapshot[K, V]) Iterator() *TreeIterator[K, V] {
+	c := &cursor[K, V]{}
+	if s.root != nil {
+		c.descendFirst(s.root)
+	}
+
+	return &TreeIterator[K, V]{c, nil}
+}
+
+// own returns the node that can be modified in place. If the node belongs
+// to another generation, it might be shared with the snapshots or the other
+// versions of the tree, so it is copied, and the copy replaces it at the position
+// of the parent, or the root if the parent is nil. The parent must be owned.
+func (t *Tree[K, V]) own(parent *node[K, V], position int, n *node[K, V]) *node[K, V] {
+	if n.generation == t.generation {
+		if n.frame != nil {
+			n.frame.dirty = true
+		}
+
+		return n
+	}
+
+	c := t.newNode(n.leaf)
+	c.keyNum = n.keyNum
+	if n.state != nil {
+		c.state.prefix, c.state.count = n.state.prefix, n.state.count
+	}
+	copy(c.keys, n.keys)
+	copy(c.values, n.values)
+	copy(c.children, n.children)
+
+	if parent == nil {
+		t.root = c
+	} else {
+		parent.children[position] = c
+	}
+
+	return c
+}
+
+// ownPath owns the nodes on the path from the root to the leaf
+// and returns the owned leaf, so the whole path can be modified in place.
+func (t *Tree[K, V]) ownPath(p *path[K, V], leaf *node[K, V]) *node[K, V] {
+	var parent *node[K, V]
+	position := 0
+	for i, n := range p.nodes {
+		p.nodes[i] = t.own(parent, position, n)
+		parent, position = p.nodes[i], p.positions[i]
+	}
+
+	return t.own(parent, position, leaf)
+}
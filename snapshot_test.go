@@ -0,0 +1,227 @@
+package bptree
+
+import (
+	"fmt"
+	"math/rand"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+)
+
+func ExampleBPTree_Snapshot() {
+	tree, _ := New()
+	tree.Put([]byte("apple"), []byte("sweet"))
+	tree.Put([]byte("banana"), []byte("honey"))
+
+	snapshot, _ := tree.Snapshot()
+	tree.Put([]byte("apple"), []byte("sour"))
+	tree.Delete([]byte("banana"))
+
+	snapshot.ForEach(func(key, value []byte) {
+		fmt.Printf("key = %s, value = %s\n", string(key), string(value))
+	})
+
+	// Output:
+	// key = apple, value = sweet
+	// key = banana, value = honey
+}
+
+func TestSnapshotOfEmptyTree(t *testing.T) {
+	tree, _ := New()
+
+	snapshot, _ := tree.Snapshot()
+	tree.Put([]byte{1}, []byte{1})
+
+	if _, ok := snapshot.Get([]byte{1}); ok {
+		t.Fatal("the snapshot of the empty tree must be empty")
+	}
+	if snapshot.Size() != 0 {
+		t.Fatalf("expected size 0, but got %d", snapshot.Size())
+	}
+
+	it := snapshot.Iterator()
+	if it.HasNext() {
+		t.Fatal("the snapshot of the empty tree must be empty")
+	}
+	defer func() {
+		if r := recover(); r == nil {
+			t.Error("Next must panic on the empty snapshot")
+		}
+	}()
+	it.Next()
+}
+
+func TestSnapshotSharesNodes(t *testing.T) {
+	tree, _ := NewTree[int, int](Order(3))
+	for i := 0; i < 100; i++ {
+		tree.Put(i, i)
+	}
+
+	root := tree.root
+	snapshot, _ := tree.Snapshot()
+	if snapshot.root != root {
+		t.Fatal("the snapshot must share the root with the tree")
+	}
+
+	tree.Put(50, -50)
+	if tree.root == root {
+		t.Fatal("the tree must copy the shared root before it modifies it")
+	}
+	if value, _ := snapshot.Get(50); value != 50 {
+		t.Fatalf("expected 50 in the snapshot, but got %d", value)
+	}
+	if value, _ := tree.Get(50); value != -50 {
+		t.Fatalf("expected -50 in the tree, but got %d", value)
+	}
+
+	// the nodes of the current generation are modified in place
+	root = tree.root
+	tree.Put(51, -51)
+	if tree.root != root {
+		t.Fatal("the tree must not copy the nodes of the current generation")
+	}
+}
+
+func TestSnapshotOverrideAfterMerge(t *testing.T) {
+	tree, _ := NewTree[int, int](Order(3))
+	for i := 0; i < 4; i++ {
+		tree.Put(i, i)
+	}
+	tree.Delete(3)
+
+	snapshot, _ := tree.Snapshot()
+
+	// the leftmost leaf is merged with its right sibling
+	tree.Delete(0)
+	tree.Put(1, -1)
+	tree.Put(2, -2)
+
+	assertSnapshot(t, snapshot, map[int]int{0: 0, 1: 1, 2: 2})
+}
+
+func TestSnapshotsRandomized(t *testing.T) {
+	for order := 3; order <= 7; order++ {
+		for _, options := range [][]Option{{Order(order)}, {Order(order), Counted()}} {
+			tree, _ := NewTree[int, int](options...)
+			expected := make(map[int]int)
+
+			snapshots := make([]*TreeSnapshot[int, int], 0)
+			states := make([]map[int]int, 0)
+
+			r := rand.New(rand.NewSource(int64(order)))
+			for i := 0; i < 3000; i++ {
+				if i%100 == 0 {
+					state := make(map[int]int)
+					for key, value := range expected {
+						state[key] = value
+					}
+
+					snapshot, _ := tree.Snapshot()
+					snapshots = append(snapshots, snapshot)
+					states = append(states, state)
+				}
+
+				key := r.Intn(300)
+				switch r.Intn(10) {
+				case 0:
+					end := key + r.Intn(30)
+					tree.DeleteRange(key, end)
+					for k := key; k < end; k++ {
+						delete(expected, k)
+					}
+				case 1, 2, 3, 4:
+					tree.Delete(key)
+					delete(expected, key)
+				default:
+					tree.Put(key, i)
+					expected[key] = i
+				}
+			}
+
+			assertInvariants(t, tree)
+			snapshot, _ := tree.Snapshot()
+			assertSnapshot(t, snapshot, expected)
+
+			// the values are overridden in place, and must not leak into the snapshots
+			for key := range expected {
+				tree.Put(key, -1)
+			}
+
+			for i, snapshot := range snapshots {
+				assertSnapshot(t, snapshot, states[i])
+			}
+		}
+	}
+}
+
+func TestSnapshotReadConcurrently(t *testing.T) {
+	tree, _ := New(Order(4))
+	for k := 0; k < 1000; k++ {
+		tree.Put(rankKey(k), rankKey(k))
+	}
+
+	snapshot, _ := tree.Snapshot()
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		for k := 0; k < 1000; k++ {
+			tree.Delete(rankKey(k))
+			tree.Put(rankKey(k+1000), rankKey(k))
+		}
+	}()
+
+	for reader := 0; reader < 2; reader++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			i := 0
+			snapshot.ForEach(func(key, value []byte) {
+				if !reflect.DeepEqual(key, rankKey(i)) {
+					t.Errorf("expected %v, but got %v", rankKey(i), key)
+				}
+				i++
+			})
+		}()
+	}
+
+	wg.Wait()
+}
+
+// assertSnapshot checks that the snapshot contains exactly the expected keys and values.
+func assertSnapshot(t *testing.T, snapshot *TreeSnapshot[int, int], expected map[int]int) {
+	t.Helper()
+
+	keys := make([]int, 0, len(expected))
+	for key := range expected {
+		keys = append(keys, key)
+	}
+	sort.Ints(keys)
+
+	actual := make([]int, 0)
+	snapshot.ForEach(func(key, value int) {
+		if value != expected[key] {
+			t.Fatalf("expected %d for %d, but got %d", expected[key], key, value)
+		}
+		actual = append(actual, key)
+	})
+	if !reflect.DeepEqual(keys, actual) {
+		t.Fatalf("%v != %v", keys, actual)
+	}
+
+	for key := -1; key <= 330; key++ {
+		value, ok := snapshot.Get(key)
+		expectedValue, expectedOK := expected[key]
+		if value != expectedValue || ok != expectedOK {
+			t.Fatalf("got %d, %v for %d, but expected %d, %v", value, ok, key, expectedValue, expectedOK)
+		}
+	}
+
+	if snapshot.Size() != len(expected) {
+		t.Fatalf("expected size %d, but got %d", len(expected), snapshot.Size())
+	}
+}
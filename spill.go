@@ -0,0 +1,73 @@
+package bptree
+
+import (
+	"fmt"
+	"os"
+)
+
+// MemoryLimit sets the approximate maximum number of bytes taken by the nodes
+// that the tree keeps in memory. The tree returned by New spills the cold nodes
+// to a scratch file and loads them back on access, and the file-backed tree
+// evicts them to its file. The size of a changed node is estimated again
+// only when it is written, and the root and the leaves pinned by the iterators
+// are never evicted, so the tree might take more memory than the limit.
+// The iterators abandoned before the end of the iteration must be closed
+// to unpin their leaves. The tree that spills its nodes does not support
+// snapshots and versions, so Snapshot, With and Without return an error.
+func MemoryLimit(bytes int) Option {
+	return func(o *options) error {
+		if bytes < 1 {
+			return fmt.Errorf("memory limit must be >= 1")
+		}
+
+		o.memoryLimit = bytes
+
+		return nil
+	}
+}
+
+// spill makes the tree keep its nodes in the pages of a scratch file
+// and only a limited number of them in memory. The scratch file is removed
+// by Close.
+func spill(t *Tree[[]byte, []byte], o *options) error {
+	file, err := os.CreateTemp("", "bptree-*.spill")
+	if err != nil {
+		return err
+	}
+
+	p := &pager{file: file, pageSize: o.pageSize, pageNum: 1}
+	t.store = newPageStore(t, p, bytesCodec, o)
+	t.store.scratch = true
+
+	return nil
+}
+
+// CacheStats are the counters of the nodes of the tree that stores its nodes
+// in a file, which help to tune its CacheSize and MemoryLimit.
+type CacheStats struct {
+	// the number of accesses to the nodes in memory
+	Hits uint64
+
+	// the number of accesses to the evicted nodes, which are loaded from the file
+	Misses uint64
+
+	// the number of evicted nodes
+	Evictions uint64
+
+	// the number of nodes in memory and the estimated number of bytes taken by them
+	Nodes int
+	Bytes int
+}
+
+// CacheStats returns the counters of the nodes of the tree that stores
+// its nodes in a file, or zero counters for the in-memory tree.
+func (t *Tree[K, V]) CacheStats() CacheStats {
+	if t.store == nil {
+		return CacheStats{}
+	}
+
+	stats := t.store.stats
+	stats.Nodes, stats.Bytes = len(t.store.resident), t.store.bytes
+
+	return stats
+}
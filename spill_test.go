@@ -0,0 +1,278 @@
+package bptree
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"os"
+	"strings"
+	"testing"
+)
+
+func ExampleMemoryLimit() {
+	tree, _ := New(MemoryLimit(64 << 20))
+	defer tree.Close()
+
+	tree.Put([]byte("apple"), []byte("red"))
+	value, _ := tree.Get([]byte("apple"))
+	fmt.Printf("apple = %s\n", value)
+	// Output:
+	// apple = red
+}
+
+func TestMemoryLimitErrors(t *testing.T) {
+	if _, err := New(MemoryLimit(0)); err == nil {
+		t.Fatal("expected the memory limit error")
+	}
+	if _, err := NewTree[int, int](MemoryLimit(1024)); err == nil {
+		t.Fatal("expected the error for the generic tree")
+	}
+	if _, err := NewConcurrent(CacheSize(10)); err == nil {
+		t.Fatal("expected the error for the concurrent tree")
+	}
+	if _, err := New(Comparator(func(x, y int) int { return x - y })); err == nil {
+		t.Fatal("expected the comparator error")
+	}
+
+	t.Setenv("TMPDIR", "/nonexistent/directory")
+	if _, err := New(MemoryLimit(1024)); err == nil {
+		t.Fatal("expected the scratch file error")
+	}
+}
+
+func TestSpillRandomized(t *testing.T) {
+	for order := 3; order <= 7; order++ {
+		tree, err := New(Order(order), PageSize(128), MemoryLimit(4096))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		expected := make(map[string][]byte)
+
+		r := rand.New(rand.NewSource(int64(order)))
+		for i := 0; i < 3000; i++ {
+			key := r.Intn(300)
+			switch r.Intn(10) {
+			case 0:
+				end := key + r.Intn(30)
+				tree.DeleteRange(rankKey(key), rankKey(end))
+				for k := key; k < end; k++ {
+					delete(expected, string(rankKey(k)))
+				}
+			case 1, 2, 3, 4:
+				tree.Delete(rankKey(key))
+				delete(expected, string(rankKey(key)))
+			default:
+				value := bytes.Repeat([]byte{byte(i)}, r.Intn(300))
+				tree.Put(rankKey(key), value)
+				expected[string(rankKey(key))] = value
+			}
+		}
+
+		assertFile(t, tree, expected)
+
+		tree.store.evict()
+		stats := tree.CacheStats()
+		if stats.Bytes > 4096 {
+			t.Fatalf("expected at most 4096 bytes in memory, but got %d", stats.Bytes)
+		}
+		if stats.Hits == 0 || stats.Misses == 0 || stats.Evictions == 0 {
+			t.Fatalf("expected hits, misses and evictions, but got %+v", stats)
+		}
+
+		size := 0
+		for _, n := range tree.store.resident {
+			size += n.frame.size
+		}
+		if stats.Nodes != len(tree.store.resident) || stats.Bytes != size {
+			t.Fatalf("expected %d nodes and %d bytes, but got %+v", len(tree.store.resident), size, stats)
+		}
+
+		name := tree.store.pager.file.Name()
+		if err := tree.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := os.Stat(name); !os.IsNotExist(err) {
+			t.Fatalf("expected the scratch file to be removed, but got %v", err)
+		}
+	}
+}
+
+func TestSpillFromSorted(t *testing.T) {
+	for _, fillFactor := range []float64{0.5, 1.0} {
+		for size := 0; size <= 20; size++ {
+			keys := make([][]byte, size)
+			expected := make(map[string][]byte)
+			for i := range keys {
+				keys[i] = rankKey(i)
+				expected[string(keys[i])] = keys[i]
+			}
+
+			// the leaves are linked as they are built
+			tree, err := NewFromSorted(&sliceIterator{keys}, fillFactor, Order(5), CacheSize(3))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			assertFile(t, tree, expected)
+
+			// the leaf merged into the previous one releases its page
+			var count func(n *node[[]byte, []byte]) uint64
+			count = func(n *node[[]byte, []byte]) uint64 {
+				if n.leaf {
+					return 1
+				}
+
+				nodes := uint64(1)
+				for i := 0; i <= n.keyNum; i++ {
+					nodes += count(n.child(i))
+				}
+
+				return nodes
+			}
+			if pager := tree.store.pager; tree.root != nil && pager.pageNum-1-uint64(len(pager.free)) != count(tree.root) {
+				t.Fatalf("expected %d pages in use, but got %d", count(tree.root), pager.pageNum-1-uint64(len(pager.free)))
+			}
+
+			tree.Close()
+		}
+	}
+}
+
+func TestSpillIteratorPinsLeaf(t *testing.T) {
+	tree, _ := New(Order(3), MemoryLimit(1))
+	defer tree.Close()
+
+	for i := 0; i < 100; i++ {
+		tree.Put(rankKey(i), rankKey(i))
+	}
+
+	i := 0
+	for it := tree.Iterator(); it.HasNext(); i++ {
+		leaf := it.cursor.leaf()
+
+		// evicts all nodes except the root and the pinned path
+		tree.Get(rankKey(99 - i))
+		if leaf.keys == nil {
+			t.Fatal("the pinned leaf must not be evicted")
+		}
+
+		key, _ := it.Next()
+		if !bytes.Equal(key, rankKey(i)) {
+			t.Fatalf("expected %v, but got %v", rankKey(i), key)
+		}
+	}
+	if i != 100 {
+		t.Fatalf("expected 100 keys, but got %d", i)
+	}
+}
+
+func TestSpillAbandonedIterators(t *testing.T) {
+	tree, _ := New(Order(3), MemoryLimit(1))
+	defer tree.Close()
+
+	for i := 0; i < 100; i++ {
+		tree.Put(rankKey(i), rankKey(i))
+	}
+
+	// the iterators abandoned in the middle of the iteration are closed,
+	// so their leaves are evicted
+	for i := 0; i < 100; i++ {
+		it := tree.Seek(rankKey(i))
+		it.Next()
+		it.Close()
+		it.Close()
+		if it.HasNext() {
+			t.Fatal("expected the closed iterator to be over")
+		}
+
+		reverse := tree.ReverseIterator()
+		reverse.Next()
+		reverse.Close()
+		if reverse.HasNext() {
+			t.Fatal("expected the closed iterator to be over")
+		}
+
+		txn := tree.Begin()
+		txn.Put(rankKey(i), nil)
+		txnIt := txn.Iterator()
+		txnIt.Next()
+		txnIt.Close()
+		if txnIt.HasNext() {
+			t.Fatal("expected the closed iterator to be over")
+		}
+		txn.Rollback()
+	}
+
+	tree.store.evict()
+	if len(tree.store.resident) > 1 {
+		t.Fatalf("expected only the root in memory, but got %d nodes", len(tree.store.resident))
+	}
+
+	// the iterator that is neither closed nor over keeps its leaf
+	it := tree.Iterator()
+	it.Next()
+	tree.store.evict()
+	if it.cursor.leaf().keys == nil {
+		t.Fatal("the pinned leaf must not be evicted")
+	}
+	it.Close()
+}
+
+func TestSpillUnsupported(t *testing.T) {
+	tree, _ := New(CacheSize(10))
+	defer tree.Close()
+
+	if _, err := tree.Snapshot(); err == nil || !strings.Contains(err.Error(), "snapshots are not supported") {
+		t.Errorf("expected the snapshots error, but got %v", err)
+	}
+	if _, err := tree.With([]byte("a"), nil); err == nil || !strings.Contains(err.Error(), "versions are not supported") {
+		t.Errorf("expected the versions error, but got %v", err)
+	}
+}
+
+func TestSpillReadErrors(t *testing.T) {
+	tree, _ := New(Order(3), PageSize(128), CacheSize(1))
+	for i := 0; i < 100; i++ {
+		tree.Put(rankKey(i), rankKey(i))
+	}
+
+	// the first leaf is written to the scratch file and corrupted there
+	page := tree.first().leaf().frame.page
+	tree.store.evict()
+	tree.store.pager.file.WriteAt([]byte{0xff}, int64(page)*128+nodeHeaderSize)
+
+	if _, ok := tree.Get(rankKey(0)); ok {
+		t.Fatal("expected the key in the corrupted leaf to be missing")
+	}
+	if err := tree.Err(); err == nil || !strings.Contains(err.Error(), "failed to load") {
+		t.Fatalf("expected the load error, but got %v", err)
+	}
+
+	name := tree.store.pager.file.Name()
+	if err := tree.Close(); err == nil || !strings.Contains(err.Error(), "failed to load") {
+		t.Fatalf("expected the load error, but got %v", err)
+	}
+	if _, err := os.Stat(name); !os.IsNotExist(err) {
+		t.Fatalf("expected the scratch file to be removed, but got %v", err)
+	}
+}
+
+func TestSpillCloseErrors(t *testing.T) {
+	tree, _ := New(CacheSize(10))
+
+	tree.store.pager.file.Close()
+	if err := tree.Close(); err == nil {
+		t.Fatal("expected the close error")
+	}
+}
+
+func TestCacheStatsInMemory(t *testing.T) {
+	tree, _ := New()
+	tree.Put([]byte("a"), []byte("b"))
+	tree.Get([]byte("a"))
+
+	if stats := tree.CacheStats(); stats != (CacheStats{}) {
+		t.Fatalf("expected zero counters, but got %+v", stats)
+	}
+}
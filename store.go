@@ -0,0 +1,670 @@
+package bptree
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"math"
+	"os"
+)
+
+const (
+	defaultCacheSize = 1024
+
+	// the estimated number of bytes taken by the node and its frame,
+	// and by each slot of the key and the value or the child in memory
+	nodeFootprint = 160
+	slotFootprint = 48
+)
+
+// CacheSize sets the maximum number of nodes that the file-backed tree
+// or the tree returned by New keeps in memory. The minimum is 1, and
+// the default for the file-backed tree is 1024 nodes, unless MemoryLimit
+// is set. The root and the leaves pinned by the iterators are never evicted,
+// so they are kept in memory even beyond the limit, and the iterators
+// abandoned before the end of the iteration must be closed to unpin them.
+// The tree that spills its nodes does not support snapshots and versions,
+// so Snapshot, With and Without return an error.
+func CacheSize(nodes int) Option {
+	return func(o *options) error {
+		if nodes < 1 {
+			return fmt.Errorf("cache size must be >= 1")
+		}
+
+		o.cacheSize = nodes
+
+		return nil
+	}
+}
+
+// Open opens the file-backed tree stored in the file at the path, or creates
+// the file if it does not exist. The nodes are stored in the fixed-size pages
+// of the file, and only the nodes in use are kept in memory. The other ones are
+// evicted and loaded from their pages again on access. See the page layout
+// in pager.go.
+//
+// The order, the counted mode and the page size of the existing file are read
+// from it, so Order, Counted and PageSize return an error if they do not match
+// the file, and the comparator must be the same as the one the file was
+// written with. The changes are written to the file when the changed nodes
+// are evicted and by Close, which must be called to keep the file consistent.
+// The errors of writing are returned by Close. Since the operations do not
+// return errors, a page that cannot be read is read as an empty node, and
+// the tree refuses all further changes and does not write the file anymore.
+// Err and Close return the error.
+//
+// The file-backed tree does not support snapshots and versions. An iterator
+// keeps its current leaf in memory until the iteration is over.
+func Open(path string, options ...Option) (*BPTree, error) {
+	o, err := newOptions(options)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	p, h, err := openPager(file, o.pageSize)
+	if err != nil {
+		file.Close()
+
+		return nil, err
+	}
+
+	if h != nil {
+		err := checkHeader(h, o)
+		if err != nil {
+			file.Close()
+
+			return nil, err
+		}
+
+		o.order, o.counted = h.order, h.counted
+	}
+	if o.cacheSize == 0 && o.memoryLimit == 0 {
+		o.cacheSize = defaultCacheSize
+	}
+
+	t, err := newBytesTree(o)
+	if err != nil {
+		file.Close()
+
+		return nil, err
+	}
+
+	t.store = newPageStore(t, p, bytesCodec, o)
+
+	if h != nil && h.root != 0 {
+		root := t.store.stub(h.root, false)
+		err := t.store.load(root)
+		if err != nil {
+			file.Close()
+
+			return nil, err
+		}
+
+		t.store.keep(root)
+		t.root, t.size = root, h.size
+	}
+
+	return &BPTree{t}, nil
+}
+
+// Close writes the changes of the file-backed tree to the file and closes it,
+// or removes the scratch file of the tree that spills its nodes, and flushes
+// and closes the log of the logged tree. The tree must not be used after Close.
+// Does nothing for the in-memory tree.
+func (t *BPTree) Close() error {
+	var err error
+	if t.log != nil {
+		err = t.log.close()
+	}
+	if t.store != nil {
+		err = firstError(err, t.store.close())
+	}
+
+	return err
+}
+
+// checkHeader returns an error if the options conflict with the header
+// of the existing file.
+func checkHeader(h *header, o *options) error {
+	if o.orderSet && o.order != h.order {
+		return fmt.Errorf("order %d does not match the order %d of the file", o.order, h.order)
+	}
+	if o.pageSizeSet && o.pageSize != h.pageSize {
+		return fmt.Errorf("page size %d does not match the page size %d of the file", o.pageSize, h.pageSize)
+	}
+	if o.counted && !h.counted {
+		return fmt.Errorf("file is not in the counted mode")
+	}
+
+	return nil
+}
+
+// storeErr returns the error of reading the pages of the tree that stores
+// its nodes in a file, after which the tree refuses the changes.
+func (t *Tree[K, V]) storeErr() error {
+	if t.store == nil {
+		return nil
+	}
+
+	return t.store.readErr
+}
+
+// inMemory returns an error if the tree stores its nodes in a file,
+// since the feature is not supported by it.
+func (t *Tree[K, V]) inMemory(feature string) error {
+	if t.store != nil {
+		return fmt.Errorf("%s are not supported by the tree that stores its nodes in a file", feature)
+	}
+
+	return nil
+}
+
+// frame keeps the state of the node of the file-backed tree. The evicted
+// node stays in its parent, but it is hollow: only its frame and the leaf flag
+// are kept, and the keys and the values or the children are loaded from its pages on access.
+// The node is evicted only if all of its children are evicted, so the nodes
+// in memory are always connected to the root.
+type frame[K, V any] struct {
+	store *pageStore[K, V]
+
+	// the first page of the node and the overflow pages
+	// for the rest of it
+	page     uint64
+	overflow []uint64
+
+	// the first page of the next leaf, 0 for the last leaf
+	next uint64
+
+	// true if the node is changed since it was written
+	dirty bool
+
+	// true if the node is accessed since the eviction passed it
+	referenced bool
+
+	// the number of cursors that pin the leaf in memory
+	pins int
+
+	// the position of the node in the nodes in memory, -1 if it is evicted
+	slot int
+
+	// the estimated number of bytes taken by the node in memory
+	// as of the last time it was loaded or written
+	size int
+}
+
+// codec encodes the keys and the values of the file-backed tree.
+type codec[K, V any] struct {
+	appendKey   func(b []byte, key K) []byte
+	readKey     func(b []byte) (K, []byte, error)
+	appendValue func(b []byte, value V) []byte
+	readValue   func(b []byte) (V, []byte, error)
+}
+
+// bytesCodec encodes the byte slices prefixed by their length.
+var bytesCodec = codec[[]byte, []byte]{appendBytes, readBytes, appendBytes, readBytes}
+
+// appendBytes appends the length of the byte slice and the slice itself.
+func appendBytes(b []byte, s []byte) []byte {
+	b = binary.AppendUvarint(b, uint64(len(s)))
+
+	return append(b, s...)
+}
+
+// readBytes reads the byte slice written by appendBytes and returns
+// a copy of it and the rest of the buffer.
+func readBytes(b []byte) ([]byte, []byte, error) {
+	size, n := binary.Uvarint(b)
+	if n <= 0 || size > uint64(len(b)-n) {
+		return nil, nil, fmt.Errorf("malformed byte slice")
+	}
+
+	end := n + int(size)
+
+	return copyBytes(b[n:end]), b[end:], nil
+}
+
+// pageStore keeps the nodes of the tree in the pages of the file and
+// a limited number of them in memory. It evicts the nodes with the CLOCK
+// algorithm: the eviction hand sweeps over the nodes in memory, gives a second
+// chance to the recently accessed ones and evicts the others.
+type pageStore[K, V any] struct {
+	tree  *Tree[K, V]
+	pager *pager
+	codec codec[K, V]
+
+	// the maximum number of nodes and bytes in memory
+	capacity int
+	limit    int
+
+	// the nodes in memory, the estimated number of bytes taken
+	// by them and the position of the eviction hand
+	resident []*node[K, V]
+	bytes    int
+	hand     int
+
+	// true if the file is the scratch file of the in-memory tree,
+	// which is removed by Close
+	scratch bool
+
+	stats CacheStats
+
+	// the first error of writing the pages, returned by Close
+	err error
+
+	// the first error of reading the pages, after which the tree refuses
+	// the changes and the pages are not written anymore
+	readErr error
+}
+
+// newPageStore returns the store of the nodes of the tree in the pages
+// limited by the options.
+func newPageStore[K, V any](t *Tree[K, V], p *pager, c codec[K, V], o *options) *pageStore[K, V] {
+	s := &pageStore[K, V]{tree: t, pager: p, codec: c, capacity: o.cacheSize, limit: o.memoryLimit}
+	if s.capacity == 0 {
+		s.capacity = math.MaxInt
+	}
+	if s.limit == 0 {
+		s.limit = math.MaxInt
+	}
+
+	return s
+}
+
+// attach allocates the page for the new node and keeps the node in memory.
+func (s *pageStore[K, V]) attach(n *node[K, V]) {
+	n.frame = &frame[K, V]{store: s, page: s.pager.allocate(), dirty: true, size: s.footprint(0)}
+	s.keep(n)
+}
+
+// stub returns the hollow node stored in the page.
+func (s *pageStore[K, V]) stub(page uint64, leaf bool) *node[K, V] {
+	return &node[K, V]{
+		leaf:       leaf,
+		frame:      &frame[K, V]{store: s, page: page, slot: -1},
+		generation: s.tree.generation,
+	}
+}
+
+// keep adds the node to the nodes in memory.
+func (s *pageStore[K, V]) keep(n *node[K, V]) {
+	n.frame.referenced = true
+	n.frame.slot = len(s.resident)
+	s.resident = append(s.resident, n)
+	s.bytes += n.frame.size
+}
+
+// forget removes the node from the nodes in memory.
+func (s *pageStore[K, V]) forget(n *node[K, V]) {
+	last := s.resident[len(s.resident)-1]
+	last.frame.slot = n.frame.slot
+	s.resident[n.frame.slot] = last
+	s.resident = s.resident[:len(s.resident)-1]
+	s.bytes -= n.frame.size
+
+	n.frame.slot = -1
+}
+
+// footprint estimates the number of bytes taken in memory by the node
+// with the payload of the given length: the node itself, the slots
+// of the keys and the values or the children, and the keys and the values.
+func (s *pageStore[K, V]) footprint(length int) int {
+	return nodeFootprint + s.tree.order*slotFootprint + length
+}
+
+// access loads the node if it is evicted and marks it as recently accessed.
+func (s *pageStore[K, V]) access(n *node[K, V]) {
+	if n.keys == nil {
+		s.stats.Misses++
+
+		err := s.load(n)
+		if err != nil {
+			// the operations do not return errors, so the node
+			// is read as an empty one, and Err returns the error
+			s.readErr = firstError(s.readErr, fmt.Errorf("failed to load the node from page %d: %w", n.frame.page, err))
+			s.empty(n)
+
+			return
+		}
+
+		s.keep(n)
+	} else {
+		s.stats.Hits++
+	}
+
+	n.frame.referenced = true
+}
+
+// empty makes the node that cannot be read empty, and the empty internal node
+// gets an empty leaf as its only child. The node is not kept with the nodes
+// in memory, so it is neither loaded again nor evicted.
+func (s *pageStore[K, V]) empty(n *node[K, V]) {
+	n.keys, n.keyNum, n.values, n.children = make([]K, s.tree.order-1), 0, nil, nil
+	if n.leaf {
+		n.values = make([]V, s.tree.order-1)
+	} else {
+		n.children = make([]*node[K, V], s.tree.order)
+		n.children[0] = s.stub(0, true)
+		s.empty(n.children[0])
+	}
+
+	s.tree.giveState(n)
+	if n.state != nil {
+		n.state.prefix, n.state.count = nil, 0
+	}
+}
+
+// load reads the keys and the values or the children of the node from its pages.
+func (s *pageStore[K, V]) load(n *node[K, V]) error {
+	f := n.frame
+
+	b := make([]byte, s.pager.pageSize)
+	err := s.pager.read(f.page, b)
+	if err != nil {
+		return err
+	}
+
+	pageType, leafChildren := b[0], b[1] == 1
+	keyNum := int(binary.LittleEndian.Uint32(b[4:]))
+	next := binary.LittleEndian.Uint64(b[8:])
+	count := int(binary.LittleEndian.Uint64(b[16:]))
+	length := int(binary.LittleEndian.Uint32(b[32:]))
+	checksum := binary.LittleEndian.Uint32(b[36:])
+	if (pageType != leafPage && pageType != internalPage) || keyNum >= s.tree.order {
+		return fmt.Errorf("malformed node page")
+	}
+
+	payload := make([]byte, 0, length)
+	payload = append(payload, b[nodeHeaderSize:min(nodeHeaderSize+length, len(b))]...)
+
+	f.overflow = f.overflow[:0]
+	for page := binary.LittleEndian.Uint64(b[24:]); page != 0; page = binary.LittleEndian.Uint64(b[8:]) {
+		err := s.pager.read(page, b)
+		if err != nil {
+			return err
+		}
+
+		f.overflow = append(f.overflow, page)
+		rest := max(length-len(payload), 0)
+		payload = append(payload, b[overflowHeaderSize:min(overflowHeaderSize+rest, len(b))]...)
+	}
+
+	if len(payload) != length || crc32.ChecksumIEEE(payload) != checksum {
+		return fmt.Errorf("checksum mismatch")
+	}
+
+	n.leaf = pageType == leafPage
+	s.tree.giveState(n)
+	n.keys = make([]K, s.tree.order-1)
+	if n.leaf {
+		n.values = make([]V, s.tree.order-1)
+	} else {
+		n.children = make([]*node[K, V], s.tree.order)
+	}
+	if n.state != nil {
+		n.state.count = count
+	}
+	f.next, f.size = next, s.footprint(length)
+
+	for n.keyNum = 0; n.keyNum < keyNum; n.keyNum++ {
+		n.keys[n.keyNum], payload, err = s.codec.readKey(payload)
+		if err != nil {
+			return err
+		}
+
+		if n.leaf {
+			n.values[n.keyNum], payload, err = s.codec.readValue(payload)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	if n.leaf {
+		// the file keeps the whole keys
+		s.tree.compress(n)
+	} else {
+		if len(payload) != 8*(keyNum+1) {
+			return fmt.Errorf("malformed node page")
+		}
+
+		for i := 0; i <= keyNum; i++ {
+			n.children[i] = s.stub(binary.LittleEndian.Uint64(payload[8*i:]), leafChildren)
+		}
+	}
+
+	return nil
+}
+
+// write writes the node to its pages. Nothing is written after reading
+// the pages failed, since the operation that failed might have left
+// the nodes inconsistent.
+func (s *pageStore[K, V]) write(n *node[K, V]) error {
+	if s.readErr != nil {
+		return s.readErr
+	}
+
+	f := n.frame
+
+	var payload []byte
+	for i := 0; i < n.keyNum; i++ {
+		payload = s.codec.appendKey(payload, n.key(i))
+		if n.leaf {
+			payload = s.codec.appendValue(payload, n.values[i])
+		}
+	}
+	if !n.leaf {
+		for i := 0; i <= n.keyNum; i++ {
+			payload = binary.LittleEndian.AppendUint64(payload, n.children[i].frame.page)
+		}
+	}
+
+	// the overflow pages are allocated or released to fit the payload
+	overflowNum := 0
+	for rest := len(payload) - (s.pager.pageSize - nodeHeaderSize); rest > 0; rest -= s.pager.pageSize - overflowHeaderSize {
+		overflowNum++
+	}
+	for len(f.overflow) < overflowNum {
+		f.overflow = append(f.overflow, s.pager.allocate())
+	}
+	for len(f.overflow) > overflowNum {
+		s.pager.release(f.overflow[len(f.overflow)-1])
+		f.overflow = f.overflow[:len(f.overflow)-1]
+	}
+
+	b := make([]byte, s.pager.pageSize)
+	b[0] = internalPage
+	if n.leaf {
+		b[0] = leafPage
+	} else if n.children[0].leaf {
+		b[1] = 1
+	}
+	binary.LittleEndian.PutUint32(b[4:], uint32(n.keyNum))
+	binary.LittleEndian.PutUint64(b[8:], f.next)
+	if n.state != nil {
+		binary.LittleEndian.PutUint64(b[16:], uint64(n.state.count))
+	}
+	binary.LittleEndian.PutUint32(b[32:], uint32(len(payload)))
+	size := s.footprint(len(payload))
+	binary.LittleEndian.PutUint32(b[36:], crc32.ChecksumIEEE(payload))
+
+	page, header := f.page, nodeHeaderSize
+	for i := 0; ; i++ {
+		next := uint64(0)
+		if i < len(f.overflow) {
+			next = f.overflow[i]
+		}
+
+		if i == 0 {
+			binary.LittleEndian.PutUint64(b[24:], next)
+		} else {
+			b[0] = overflowPage
+			binary.LittleEndian.PutUint64(b[8:], next)
+		}
+
+		written := copy(b[header:], payload)
+		payload = payload[written:]
+		clear(b[header+written:])
+
+		err := s.pager.write(page, b)
+		if err != nil {
+			return err
+		}
+
+		if next == 0 {
+			break
+		}
+
+		page, header = next, overflowHeaderSize
+		clear(b[:header])
+	}
+
+	f.dirty = false
+
+	// only the nodes in memory are written
+	s.bytes += size - f.size
+	f.size = size
+
+	return nil
+}
+
+// release frees the pages of the node removed from the tree.
+func (s *pageStore[K, V]) release(n *node[K, V]) {
+	f := n.frame
+	if f.slot != -1 {
+		s.forget(n)
+	}
+
+	s.pager.release(f.page)
+	for _, page := range f.overflow {
+		s.pager.release(page)
+	}
+
+	f.overflow = nil
+	f.dirty = false
+}
+
+// evict evicts the nodes until their number fits into the capacity,
+// or until all nodes in memory are in use.
+func (s *pageStore[K, V]) evict() {
+	// the idle steps neither evict nor give a second chance,
+	// so after a whole sweep of them no node can be evicted
+	for idle := 0; (len(s.resident) > s.capacity || s.bytes > s.limit) && idle <= len(s.resident); {
+		if s.hand >= len(s.resident) {
+			s.hand = 0
+		}
+
+		n := s.resident[s.hand]
+		if n.frame.referenced {
+			n.frame.referenced = false
+			s.hand++
+			idle = 0
+
+			continue
+		}
+
+		if n == s.tree.root || n.frame.pins > 0 || !s.evictable(n) {
+			s.hand++
+			idle++
+
+			continue
+		}
+
+		if n.frame.dirty {
+			err := s.write(n)
+			if err != nil {
+				// the node stays in memory
+				s.err = firstError(s.err, err)
+				s.hand++
+				idle++
+
+				continue
+			}
+		}
+
+		// the last node takes the place of the evicted one under the hand
+		s.forget(n)
+		n.keys, n.keyNum, n.values, n.children = nil, 0, nil, nil
+		if n.state != nil {
+			n.state.prefix, n.state.count = nil, 0
+		}
+		s.stats.Evictions++
+		idle = 0
+	}
+}
+
+// evictable returns true if all children of the node are evicted.
+func (s *pageStore[K, V]) evictable(n *node[K, V]) bool {
+	if n.leaf {
+		return true
+	}
+
+	for i := 0; i <= n.keyNum; i++ {
+		if n.children[i].keys != nil {
+			return false
+		}
+	}
+
+	return true
+}
+
+// close writes the changed nodes and the header and closes the file,
+// or closes and removes the scratch file. After reading the pages failed,
+// the file is closed as it is, and the error is returned.
+func (s *pageStore[K, V]) close() error {
+	if s.scratch {
+		err := firstError(s.readErr, s.pager.file.Close())
+
+		return firstError(err, os.Remove(s.pager.file.Name()))
+	}
+	if s.readErr != nil {
+		return firstError(s.readErr, s.pager.file.Close())
+	}
+
+	for _, n := range s.resident {
+		if n.frame.dirty {
+			s.err = firstError(s.err, s.write(n))
+		}
+	}
+
+	h := header{order: s.tree.order, counted: s.tree.counted, size: s.tree.size}
+	if s.tree.root != nil {
+		h.root = s.tree.root.frame.page
+	}
+
+	return firstError(s.err, s.pager.close(h))
+}
+
+// link links the leaf before the deleted range to the leaf after it,
+// since the leaves within the range are removed.
+func (s *pageStore[K, V]) link(before, after *cursor[K, V]) {
+	if !before.valid() {
+		return
+	}
+
+	leaf := before.leaf()
+	next := uint64(0)
+	if after.valid() {
+		if after.leaf() == leaf {
+			// the range is within the leaf
+			return
+		}
+
+		next = after.leaf().frame.page
+	}
+
+	leaf.frame.next, leaf.frame.dirty = next, true
+}
+
+// firstError returns the first of the errors that is not nil.
+func firstError(err, another error) error {
+	if err != nil {
+		return err
+	}
+
+	return another
+}
@@ -0,0 +1,574 @@
+package bptree
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func ExampleOpen() {
+	dir, _ := os.MkdirTemp("", "bptree")
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "fruits.db")
+
+	tree, _ := Open(path, Order(64))
+	tree.Put([]byte("apple"), []byte("sweet"))
+	tree.Put([]byte("banana"), []byte("honey"))
+	tree.Close()
+
+	tree, _ = Open(path)
+	defer tree.Close()
+
+	tree.ForEach(func(key, value []byte) {
+		fmt.Printf("key = %s, value = %s\n", string(key), string(value))
+	})
+
+	// Output:
+	// key = apple, value = sweet
+	// key = banana, value = honey
+}
+
+func TestOpenErrors(t *testing.T) {
+	dir := t.TempDir()
+
+	if _, err := Open(filepath.Join(dir, "tree"), PageSize(64)); err == nil {
+		t.Error("expected the page size error")
+	}
+	if _, err := Open(filepath.Join(dir, "tree"), CacheSize(0)); err == nil {
+		t.Error("expected the cache size error")
+	}
+	if _, err := Open(filepath.Join(dir, "tree"), Comparator(func(x, y int) int { return x - y })); err == nil {
+		t.Error("expected the comparator error")
+	}
+	if _, err := Open(dir); err == nil {
+		t.Error("expected the error for the directory")
+	}
+
+	path := filepath.Join(dir, "file")
+	os.WriteFile(path, []byte("not a tree"), 0644)
+	if _, err := Open(path); err == nil {
+		t.Error("expected the error for the file that is not a tree")
+	}
+
+	tree, _ := Open(path+".db", PageSize(128))
+	for i := 0; i < 100; i++ {
+		tree.Put(rankKey(i), rankKey(i))
+	}
+	tree.DeleteRange(rankKey(10), rankKey(90))
+	tree.Close()
+
+	// the options conflict with the header of the file
+	if _, err := Open(path+".db", Order(5)); err == nil {
+		t.Error("expected the order error")
+	}
+	if _, err := Open(path+".db", Counted()); err == nil {
+		t.Error("expected the counted mode error")
+	}
+	if _, err := Open(path+".db", PageSize(defaultPageSize)); err == nil {
+		t.Error("expected the page size error")
+	}
+	tree, err := Open(path+".db", Order(defaultOrder), PageSize(128))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree.Close()
+
+	corrupt := func(offset int64, b []byte) string {
+		data, _ := os.ReadFile(path + ".db")
+		corrupted := fmt.Sprintf("%s.%d", path, offset)
+		copy(data[offset:], b)
+		os.WriteFile(corrupted, data, 0644)
+
+		return corrupted
+	}
+
+	// the version
+	if _, err := Open(corrupt(8, []byte{2})); err == nil {
+		t.Error("expected the version error")
+	}
+	// the first free page is beyond the end of the file
+	if _, err := Open(corrupt(48, []byte{0xff, 0xff})); err == nil {
+		t.Error("expected the error for the free page")
+	}
+	// the root page is beyond the end of the file
+	if _, err := Open(corrupt(24, []byte{0xff, 0xff})); err == nil {
+		t.Error("expected the error for the root page")
+	}
+}
+
+func TestFileBackedRandomized(t *testing.T) {
+	for order := 3; order <= 7; order++ {
+		for _, counted := range []bool{false, true} {
+			options := []Option{Order(order), PageSize(128), CacheSize(3)}
+			if counted {
+				options = append(options, Counted())
+			}
+
+			path := filepath.Join(t.TempDir(), "tree")
+			tree, err := Open(path, options...)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			expected := make(map[string][]byte)
+
+			r := rand.New(rand.NewSource(int64(order)))
+			for i := 0; i < 3000; i++ {
+				if i%500 == 499 {
+					// the options of the existing file are read from it
+					if err := tree.Close(); err != nil {
+						t.Fatal(err)
+					}
+					tree, err = Open(path, CacheSize(3))
+					if err != nil {
+						t.Fatal(err)
+					}
+				}
+
+				key := r.Intn(300)
+				switch r.Intn(10) {
+				case 0:
+					end := key + r.Intn(30)
+					tree.DeleteRange(rankKey(key), rankKey(end))
+					for k := key; k < end; k++ {
+						delete(expected, string(rankKey(k)))
+					}
+				case 1, 2, 3, 4:
+					tree.Delete(rankKey(key))
+					delete(expected, string(rankKey(key)))
+				default:
+					// the large values do not fit into the pages
+					value := bytes.Repeat([]byte{byte(i)}, r.Intn(300))
+					tree.Put(rankKey(key), value)
+					expected[string(rankKey(key))] = value
+				}
+			}
+
+			assertFile(t, tree, expected)
+			if err := tree.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			tree, _ = Open(path, CacheSize(3))
+			if tree.order != order || tree.counted != counted {
+				t.Fatalf("expected order %d and counted %v, but got %d and %v", order, counted, tree.order, tree.counted)
+			}
+
+			assertFile(t, tree, expected)
+			tree.Close()
+		}
+	}
+}
+
+func TestFileBackedEvictsColdNodes(t *testing.T) {
+	tree, _ := Open(filepath.Join(t.TempDir(), "tree"), Order(4), CacheSize(5))
+	defer tree.Close()
+
+	// the cold nodes are evicted before every descent, so an operation
+	// might load its path and split it beyond the limit
+	resident := make([]int, 0)
+	for i := 0; i < 1000; i++ {
+		tree.Put(rankKey(i), rankKey(i))
+		resident = append(resident, len(tree.store.resident))
+	}
+
+	height := 1
+	for n := tree.root; !n.leaf; n = n.child(0) {
+		height++
+	}
+	for i, num := range resident {
+		if num > 5+2*height {
+			t.Fatalf("expected at most %d nodes in memory after %d puts, but got %d", 5+2*height, i+1, num)
+		}
+	}
+
+	// the rank and the position are found by the scans
+	if rank, ok := tree.Rank(rankKey(700)); rank != 700 || !ok {
+		t.Fatalf("expected rank 700, but got %d, %v", rank, ok)
+	}
+	if rank, _ := tree.Rank(rankKey(1000)); rank != 1000 {
+		t.Fatalf("expected rank 1000, but got %d", rank)
+	}
+	if key, _, _ := tree.At(900); !bytes.Equal(key, rankKey(900)) {
+		t.Fatalf("expected %v, but got %v", rankKey(900), key)
+	}
+
+	tree.store.evict()
+	if len(tree.store.resident) > 5 {
+		t.Fatalf("expected at most 5 nodes in memory, but got %d", len(tree.store.resident))
+	}
+	for _, n := range tree.store.resident {
+		if n.frame.pins != 0 {
+			t.Fatal("the scans must unpin the leaves")
+		}
+	}
+}
+
+func TestFileBackedIteratorPinsLeaf(t *testing.T) {
+	tree, _ := Open(filepath.Join(t.TempDir(), "tree"), Order(3), CacheSize(1))
+	defer tree.Close()
+
+	for i := 0; i < 100; i++ {
+		tree.Put(rankKey(i), rankKey(i))
+	}
+
+	i := 0
+	for it := tree.Iterator(); it.HasNext(); i++ {
+		leaf := it.cursor.leaf()
+		if leaf.frame.pins != 1 {
+			t.Fatalf("expected the leaf to be pinned, but got %d pins", leaf.frame.pins)
+		}
+
+		// evicts all nodes except the pinned path
+		if _, ok := tree.Get(rankKey(99 - i)); !ok {
+			t.Fatalf("key %d is not found", 99-i)
+		}
+		if leaf.keys == nil {
+			t.Fatal("the pinned leaf must not be evicted")
+		}
+
+		key, _ := it.Next()
+		if !bytes.Equal(key, rankKey(i)) {
+			t.Fatalf("expected %v, but got %v", rankKey(i), key)
+		}
+	}
+	if i != 100 {
+		t.Fatalf("expected 100 keys, but got %d", i)
+	}
+
+	i = 99
+	for it := tree.ReverseIterator(); it.HasNext(); i-- {
+		tree.Get(rankKey(0))
+
+		key, _ := it.Next()
+		if !bytes.Equal(key, rankKey(i)) {
+			t.Fatalf("expected %v, but got %v", rankKey(i), key)
+		}
+	}
+
+	// the bounded iterator unpins the leaf as soon as it is out of the range
+	it := tree.Range(rankKey(10), rankKey(20))
+	for it.HasNext() {
+		it.Next()
+	}
+	if it.cursor.pinned != nil {
+		t.Fatal("the leaf must be unpinned after the iteration")
+	}
+
+	for _, n := range tree.store.resident {
+		if n.frame.pins != 0 {
+			t.Fatal("the iterations must unpin the leaves")
+		}
+	}
+}
+
+func TestFileBackedTxn(t *testing.T) {
+	tree, _ := Open(filepath.Join(t.TempDir(), "tree"), Order(3), CacheSize(1))
+	defer tree.Close()
+
+	for i := 0; i < 100; i++ {
+		tree.Put(rankKey(i), rankKey(i))
+	}
+
+	txn := tree.Begin()
+	for i := 0; i < 100; i += 2 {
+		txn.Delete(rankKey(i))
+	}
+
+	i := 1
+	for it := txn.Iterator(); it.HasNext(); i += 2 {
+		tree.Get(rankKey(0))
+
+		key, _ := it.Next()
+		if !bytes.Equal(key, rankKey(i)) {
+			t.Fatalf("expected %v, but got %v", rankKey(i), key)
+		}
+	}
+
+	txn.Commit()
+	if tree.Size() != 50 {
+		t.Fatalf("expected size 50, but got %d", tree.Size())
+	}
+}
+
+func TestFileBackedUnsupported(t *testing.T) {
+	tree, _ := Open(filepath.Join(t.TempDir(), "tree"))
+	defer tree.Close()
+
+	if _, err := tree.Snapshot(); err == nil {
+		t.Error("expected the snapshots error")
+	}
+	if _, err := tree.With([]byte{1}, []byte{1}); err == nil {
+		t.Error("expected the versions error")
+	}
+	if _, err := tree.Without([]byte{1}); err == nil {
+		t.Error("expected the versions error")
+	}
+}
+
+func TestFileBackedCorruptedPages(t *testing.T) {
+	// the leftmost leaf stays in page 1, and the large value does not fit into it
+	data := make(map[bool][]byte)
+	for _, large := range []bool{false, true} {
+		path := filepath.Join(t.TempDir(), "tree")
+		tree, _ := Open(path, Order(3), PageSize(128))
+		for i := 0; i < 20; i++ {
+			value := []byte{byte(i)}
+			if large {
+				value = bytes.Repeat(value, 200)
+			}
+
+			tree.Put(rankKey(i), value)
+		}
+		tree.Close()
+
+		data[large], _ = os.ReadFile(path)
+	}
+
+	page := func(data []byte, i int) []byte {
+		return data[i*128 : (i+1)*128]
+	}
+	root := func(data []byte) []byte {
+		return page(data, int(binary.LittleEndian.Uint64(data[24:])))
+	}
+	checksum := func(b []byte) {
+		length := int(binary.LittleEndian.Uint32(b[32:]))
+		binary.LittleEndian.PutUint32(b[36:], crc32.ChecksumIEEE(b[nodeHeaderSize:nodeHeaderSize+length]))
+	}
+
+	cases := map[string]func(data map[bool][]byte) []byte{
+		"page type": func(data map[bool][]byte) []byte {
+			page(data[false], 1)[0] = freePage
+			return data[false]
+		},
+		"checksum": func(data map[bool][]byte) []byte {
+			page(data[false], 1)[nodeHeaderSize] ^= 0xff
+			return data[false]
+		},
+		"overflow page": func(data map[bool][]byte) []byte {
+			binary.LittleEndian.PutUint64(page(data[true], 1)[24:], 1<<20)
+			return data[true]
+		},
+		"key": func(data map[bool][]byte) []byte {
+			b := page(data[false], 1)
+			b[nodeHeaderSize] = 0xff
+			checksum(b)
+			return data[false]
+		},
+		"value": func(data map[bool][]byte) []byte {
+			b := page(data[false], 1)
+			b[nodeHeaderSize+1+len(rankKey(0))] = 0xff
+			checksum(b)
+			return data[false]
+		},
+		"pointers": func(data map[bool][]byte) []byte {
+			b := root(data[false])
+			binary.LittleEndian.PutUint32(b[32:], binary.LittleEndian.Uint32(b[32:])-1)
+			checksum(b)
+			return data[false]
+		},
+	}
+
+	for name, corrupt := range cases {
+		t.Run(name, func(t *testing.T) {
+			copied := map[bool][]byte{false: bytes.Clone(data[false]), true: bytes.Clone(data[true])}
+
+			path := filepath.Join(t.TempDir(), "tree")
+			os.WriteFile(path, corrupt(copied), 0644)
+
+			tree, err := Open(path)
+			if err != nil {
+				// the root is corrupted
+				return
+			}
+
+			tree.ForEach(func(key, value []byte) {})
+			if err := tree.Err(); err == nil || !strings.Contains(err.Error(), "failed to load") {
+				t.Fatalf("expected the load error, but got %v", err)
+			}
+			if err := tree.Close(); err == nil || !strings.Contains(err.Error(), "failed to load") {
+				t.Fatalf("expected the load error, but got %v", err)
+			}
+		})
+	}
+}
+
+func TestFileBackedReadErrors(t *testing.T) {
+	for _, counted := range []bool{false, true} {
+		options := []Option{Order(3), PageSize(128)}
+		if counted {
+			options = append(options, Counted())
+		}
+
+		path := filepath.Join(t.TempDir(), "tree")
+		tree, _ := Open(path, options...)
+		for i := 0; i < 100; i++ {
+			tree.Put(rankKey(i), rankKey(i))
+		}
+
+		// the first, a middle and the last leaf and an internal node
+		// with their first keys
+		var pages []uint64
+		var keys [][]byte
+		for c := tree.first(); c.valid(); c.nextLeaf() {
+			pages = append(pages, c.leaf().frame.page)
+			keys = append(keys, c.key())
+		}
+		pages = []uint64{pages[0], pages[len(pages)/2], pages[len(pages)-1], tree.root.child(0).frame.page}
+		keys = [][]byte{keys[0], keys[len(keys)/2], keys[len(keys)-1], rankKey(0)}
+		tree.Close()
+
+		data, _ := os.ReadFile(path)
+		for i, page := range pages {
+			// the checksum of the page does not match
+			corrupted := bytes.Clone(data)
+			corrupted[int(page)*128+nodeHeaderSize] ^= 0xff
+
+			for name, fail := range map[string]func(tree *BPTree) error{
+				"put": func(tree *BPTree) error {
+					if _, overridden := tree.Put(keys[i], nil); overridden {
+						t.Fatal("expected the put to be refused")
+					}
+
+					return tree.Err()
+				},
+				"commit": func(tree *BPTree) error {
+					txn := tree.Begin()
+					txn.Put(keys[i], nil)
+
+					return txn.Commit()
+				},
+				"deletes": func(tree *BPTree) error {
+					// the nodes changed before the error are not written
+					for k := 0; k < 100; k++ {
+						tree.Delete(rankKey(k))
+					}
+
+					return tree.Err()
+				},
+			} {
+				os.WriteFile(path, corrupted, 0644)
+				tree, err := Open(path, CacheSize(3))
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if err := fail(tree); err == nil || !strings.Contains(err.Error(), "failed to load") {
+					t.Fatalf("%s: expected the load error, but got %v", name, err)
+				}
+
+				// the tree is read without the nodes that cannot be read
+				size := tree.Size()
+				for k := 0; k < 100; k++ {
+					tree.Get(rankKey(k))
+					tree.Rank(rankKey(k))
+					tree.At(k)
+				}
+				tree.ForEach(func(key, value []byte) {})
+				tree.ForEachReverse(func(key, value []byte) {})
+				tree.Min()
+				tree.Max()
+
+				// and refuses the changes
+				tree.Put(rankKey(100), nil)
+				tree.Delete(rankKey(50))
+				tree.DeleteRange(rankKey(0), rankKey(100))
+				tree.PopMin()
+				if tree.Size() != size {
+					t.Fatalf("%s: expected the changes to be refused", name)
+				}
+				if err := tree.Begin().Commit(); err == nil {
+					t.Fatalf("%s: expected the commit to be refused", name)
+				}
+
+				if err := tree.Close(); err == nil || !strings.Contains(err.Error(), "failed to load") {
+					t.Fatalf("%s: expected the load error, but got %v", name, err)
+				}
+				if current, _ := os.ReadFile(path); name != "deletes" && !bytes.Equal(current, corrupted) {
+					t.Fatalf("%s: expected the file to be kept as it is", name)
+				}
+			}
+		}
+	}
+}
+
+func TestFileBackedWriteErrors(t *testing.T) {
+	tree, _ := Open(filepath.Join(t.TempDir(), "tree"), Order(3), CacheSize(1))
+
+	// the pages can not be written after the file is closed
+	tree.store.pager.file.Close()
+	for i := 0; i < 10; i++ {
+		tree.Put(rankKey(i), rankKey(i))
+	}
+
+	if err := tree.Close(); err == nil {
+		t.Fatal("expected the write error")
+	}
+}
+
+func TestCloseInMemory(t *testing.T) {
+	tree, _ := New()
+	if err := tree.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// assertFile checks that the file-backed tree contains exactly the expected
+// keys and values, that every leaf has its own page and that the leaves
+// are linked in the key order.
+func assertFile(t *testing.T, tree *BPTree, expected map[string][]byte) {
+	t.Helper()
+
+	assertContents(t, tree, expected)
+
+	pages := make(map[uint64]bool)
+	var previous *node[[]byte, []byte]
+	for c := tree.first(); c.valid(); c.nextLeaf() {
+		page := c.leaf().frame.page
+		if page == 0 || pages[page] {
+			t.Fatalf("the leaf is stored in the page %d of another node", page)
+		}
+		if previous != nil && previous.frame.next != page {
+			t.Fatalf("the leaf links to page %d instead of %d", previous.frame.next, page)
+		}
+
+		pages[page] = true
+		previous = c.leaf()
+	}
+	if previous != nil && previous.frame.next != 0 {
+		t.Fatalf("the last leaf links to page %d", previous.frame.next)
+	}
+}
+
+// assertContents checks that the tree contains exactly the expected
+// keys and values and satisfies the B+ tree properties.
+func assertContents(t *testing.T, tree *BPTree, expected map[string][]byte) {
+	t.Helper()
+
+	keys := make([]string, 0, len(expected))
+	for key := range expected {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	actual := make([]string, 0)
+	tree.ForEach(func(key, value []byte) {
+		if !bytes.Equal(value, expected[string(key)]) {
+			t.Fatalf("unexpected value for %v", key)
+		}
+		actual = append(actual, string(key))
+	})
+	if !reflect.DeepEqual(keys, actual) {
+		t.Fatalf("%v != %v", keys, actual)
+	}
+
+	assertInvariants(t, tree.Tree)
+}
@@ -0,0 +1,42 @@
+package bptree
+
+import (
+	"cmp"
+	"fmt"
+)
+
+// NewTree returns a new instance of the B+ tree with ordered keys
+// of type K and values of type V. By default, keys are compared with cmp.Compare.
+func NewTree[K cmp.Ordered, V any](options ...Option) (*Tree[K, V], error) {
+	return newTree[K, V](cmp.Compare[K], options)
+}
+
+// NewTreeFunc returns a new instance of the B+ tree with keys of any type
+// ordered by the given comparator. It must return a negative number if x < y,
+// zero if x == y and a positive number if x > y.
+func NewTreeFunc[K, V any](compare func(x, y K) int, options ...Option) (*Tree[K, V], error) {
+	if compare == nil {
+		return nil, fmt.Errorf("comparator must not be nil")
+	}
+
+	// the comparator goes first, so the options can override it, and the keys
+	// are not considered ordered by bytes.Compare even if they are byte slices
+	return newTree[K, V](compare, append([]Option{Comparator(compare)}, options...))
+}
+
+// NewTreeFromSorted returns a new instance of the B+ tree with ordered keys
+// built from the given key-value pairs that must be sorted in ascending key order
+// without duplicates. See NewFromSorted for the details.
+func NewTreeFromSorted[K cmp.Ordered, V any](it TreeKeyValueIterator[K, V], fillFactor float64, options ...Option) (*Tree[K, V], error) {
+	t, err := NewTree[K, V](options...)
+	if err != nil {
+		return nil, err
+	}
+
+	err = t.load(it, fillFactor)
+	if err != nil {
+		return nil, err
+	}
+
+	return t, nil
+}
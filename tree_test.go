@@ -0,0 +1,164 @@
+package bptree
+
+import (
+	"fmt"
+	"math/rand"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func ExampleNewTree() {
+	tree, _ := NewTree[int, string]()
+
+	tree.Put(3, "cinnamon")
+	tree.Put(1, "apple")
+	tree.Put(2, "banana")
+
+	value, ok := tree.Get(2)
+	fmt.Println(value, ok)
+
+	for it := tree.Iterator(); it.HasNext(); {
+		key, value := it.Next()
+		fmt.Printf("key = %d, value = %s\n", key, value)
+	}
+
+	// Output:
+	// banana true
+	// key = 1, value = apple
+	// key = 2, value = banana
+	// key = 3, value = cinnamon
+}
+
+func TestNewTreeOrderError(t *testing.T) {
+	_, err := NewTree[int, int](Order(2))
+	if err == nil {
+		t.Fatal("must return an error, but it does not")
+	}
+}
+
+func TestNewTreeComparatorMismatch(t *testing.T) {
+	_, err := NewTree[int, int](Comparator(strings.Compare))
+	if err == nil {
+		t.Fatal("must return an error, but it does not")
+	}
+}
+
+func TestNewTreeFuncNilComparator(t *testing.T) {
+	_, err := NewTreeFunc[int, int](nil)
+	if err == nil {
+		t.Fatal("must return an error, but it does not")
+	}
+}
+
+func TestNewTreeFunc(t *testing.T) {
+	type point struct{ x, y int }
+
+	tree, err := NewTreeFunc[point, int](func(a, b point) int {
+		if a.x != b.x {
+			return a.x - b.x
+		}
+
+		return a.y - b.y
+	}, Order(3))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for x := 2; x >= 0; x-- {
+		for y := 2; y >= 0; y-- {
+			tree.Put(point{x, y}, 3*x+y)
+		}
+	}
+	assertInvariants(t, tree)
+
+	i := 0
+	tree.ForEach(func(key point, value int) {
+		if value != i {
+			t.Fatalf("expected %d at %v, but got %d", i, key, value)
+		}
+		i++
+	})
+	if i != 9 {
+		t.Fatalf("expected 9 keys, but got %d", i)
+	}
+}
+
+func TestTreePutAndDeleteRandomized(t *testing.T) {
+	for order := 3; order <= 7; order++ {
+		tree, err := NewTree[int, string](Order(order), Counted())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		expected := make(map[int]string)
+		r := rand.New(rand.NewSource(int64(order)))
+		for i := 0; i < 1000; i++ {
+			key := r.Intn(200)
+			if r.Intn(3) == 0 {
+				tree.Delete(key)
+				delete(expected, key)
+			} else {
+				tree.Put(key, fmt.Sprint(i))
+				expected[key] = fmt.Sprint(i)
+			}
+		}
+		assertInvariants(t, tree)
+
+		keys := make([]int, 0, len(expected))
+		for key := range expected {
+			keys = append(keys, key)
+		}
+		sort.Ints(keys)
+
+		actual := make([]int, 0, tree.Size())
+		for it := tree.Iterator(); it.HasNext(); {
+			key, value := it.Next()
+			if value != expected[key] {
+				t.Fatalf("expected %s for %d, but got %s", expected[key], key, value)
+			}
+			actual = append(actual, key)
+		}
+		if !reflect.DeepEqual(keys, actual) {
+			t.Fatalf("%v != %v", keys, actual)
+		}
+
+		for i, key := range keys {
+			rank, ok := tree.Rank(key)
+			if !ok || rank != i {
+				t.Fatalf("expected rank %d for %d, but got %d", i, key, rank)
+			}
+		}
+	}
+}
+
+func TestNewTreeFromSorted(t *testing.T) {
+	source, _ := NewTree[int, int]()
+	for i := 0; i < 100; i++ {
+		source.Put(i, -i)
+	}
+
+	tree, err := NewTreeFromSorted[int, int](source.Iterator(), 0.5, Order(4))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertInvariants(t, tree)
+
+	for i := 0; i < 100; i++ {
+		value, ok := tree.Get(i)
+		if !ok || value != -i {
+			t.Fatalf("expected %d for %d, but got %d", -i, i, value)
+		}
+	}
+
+	_, err = NewTreeFromSorted[int, int](source.Iterator(), 2)
+	if err == nil {
+		t.Fatal("must return an error, but it does not")
+	}
+
+	_, err = NewTreeFromSorted[int, int](source.Iterator(), 0.5, Order(2))
+	if err == nil {
+		t.Fatal("must return an error, but it does not")
+	}
+}
@@ -0,0 +1,257 @@
+package bptree
+
+import "fmt"
+
+// Txn is a transaction that applies a batch of changes to the tree atomically.
+type Txn = TreeTxn[[]byte, []byte]
+
+// TxnIterator is a stateful iterator for traversing the tree merged
+// with the pending changes of the transaction in ascending key order.
+type TxnIterator = TreeTxnIterator[[]byte, []byte]
+
+// TreeTxn is a transaction that applies a batch of changes to the tree
+// atomically. The changes are kept aside until Commit applies all of them
+// to the tree, and Rollback discards them, so the tree never contains only
+// a part of the batch. The transaction reads the current state of the tree
+// merged with its pending changes.
+//
+// The tree must not be changed while the transaction iterates over it,
+// and the transaction must not be used after Commit or Rollback.
+type TreeTxn[K, V any] struct {
+	tree *Tree[K, V]
+
+	// the positions of the pending changes ordered by key
+	index *Tree[K, int]
+
+	// the pending changes, the deleted keys are kept as tombstones
+	writes []pendingWrite[V]
+
+	// true after Commit or Rollback
+	done bool
+}
+
+// pendingWrite is a pending change of the value, or a tombstone
+// for the deleted key.
+type pendingWrite[V any] struct {
+	value   V
+	deleted bool
+}
+
+// Begin starts a new transaction on the tree.
+func (t *Tree[K, V]) Begin() *TreeTxn[K, V] {
+	index := &Tree[K, int]{
+		order:     t.order,
+		minKeyNum: t.minKeyNum,
+		compare:   t.compare,
+		copyKey:   t.copyKey,
+		separator: t.separator,
+	}
+
+	return &TreeTxn[K, V]{tree: t, index: index}
+}
+
+// Get returns a value by the key, taking the pending changes into account.
+// The second return value is a flag that determines if the key was found.
+func (txn *TreeTxn[K, V]) Get(key K) (V, bool) {
+	position, ok := txn.index.Get(key)
+	if !ok {
+		return txn.tree.Get(key)
+	}
+
+	w := txn.writes[position]
+	if w.deleted {
+		var zero V
+		return zero, false
+	}
+
+	return w.value, true
+}
+
+// Put puts the value by the key in the transaction.
+// Returns true and the previous value if the value has been overridden,
+// otherwise false.
+func (txn *TreeTxn[K, V]) Put(key K, value V) (V, bool) {
+	oldValue, overridden := txn.Get(key)
+	txn.write(key, pendingWrite[V]{value: value})
+
+	return oldValue, overridden
+}
+
+// Delete deletes the key in the transaction. Returns deleted value and true
+// if the key exists, otherwise nil and false.
+func (txn *TreeTxn[K, V]) Delete(key K) (V, bool) {
+	value, ok := txn.Get(key)
+	if ok {
+		txn.write(key, pendingWrite[V]{deleted: true})
+	}
+
+	return value, ok
+}
+
+// write records the pending change of the key.
+func (txn *TreeTxn[K, V]) write(key K, w pendingWrite[V]) {
+	position, ok := txn.index.Get(key)
+	if ok {
+		txn.writes[position] = w
+
+		return
+	}
+
+	txn.index.Put(key, len(txn.writes))
+	txn.writes = append(txn.writes, w)
+}
+
+// Commit applies all pending changes to the tree.
+// Returns an error if the transaction is already finished, or if writing
+// the log of the logged tree fails, and then none of the changes is applied.
+// The tree that stores its nodes in a file returns the error of reading its
+// pages, and the changes after the error are not applied.
+func (txn *TreeTxn[K, V]) Commit() error {
+	if txn.done {
+		return fmt.Errorf("transaction is already finished")
+	}
+
+	txn.done = true
+
+	if err := txn.tree.storeErr(); err != nil {
+		return err
+	}
+
+	if log := txn.tree.log; log != nil {
+		// the batch is logged as one record, so it is replayed atomically
+		var ops []byte
+		for it := txn.index.Iterator(); it.HasNext(); {
+			key, position := it.Next()
+			if w := txn.writes[position]; !w.deleted {
+				ops = log.appendPut(ops, key, w.value)
+			} else if _, ok := txn.tree.Get(key); ok {
+				ops = log.appendDelete(ops, key)
+			}
+		}
+		if len(ops) > 0 {
+			if err := log.write(ops); err != nil {
+				return err
+			}
+		}
+
+		txn.tree.log = nil
+		defer func() { txn.tree.log = log }()
+	}
+
+	for it := txn.index.Iterator(); it.HasNext(); {
+		key, position := it.Next()
+		if w := txn.writes[position]; w.deleted {
+			txn.tree.Delete(key)
+		} else {
+			txn.tree.Put(key, w.value)
+		}
+	}
+
+	return txn.tree.storeErr()
+}
+
+// Rollback discards all pending changes.
+// Returns an error if the transaction is already finished.
+func (txn *TreeTxn[K, V]) Rollback() error {
+	if txn.done {
+		return fmt.Errorf("transaction is already finished")
+	}
+
+	txn.done = true
+	txn.index, txn.writes = nil, nil
+
+	return nil
+}
+
+// Iterator returns a stateful iterator that traverses the tree merged
+// with the pending changes of the transaction in ascending key order.
+func (txn *TreeTxn[K, V]) Iterator() *TreeTxnIterator[K, V] {
+	base := txn.tree.first()
+	base.pin()
+
+	return &TreeTxnIterator[K, V]{txn.tree.compare, base, txn.index.first(), txn.writes}
+}
+
+// TreeTxnIterator is a stateful iterator for traversing the tree merged
+// with the pending changes of the transaction in ascending key order.
+type TreeTxnIterator[K, V any] struct {
+	compare func(x, y K) int
+
+	// the cursors of the tree and of the pending changes
+	base   *cursor[K, V]
+	index  *cursor[K, int]
+	writes []pendingWrite[V]
+}
+
+// HasNext returns true if there is a next element to retrive.
+func (it *TreeTxnIterator[K, V]) HasNext() bool {
+	it.skipDeleted()
+
+	return it.base.valid() || it.index.valid()
+}
+
+// Next returns a key and a value at the current position of the iteration
+// and advances the iterator.
+// Caution! Next panics if called on the nil element.
+func (it *TreeTxnIterator[K, V]) Next() (K, V) {
+	if !it.HasNext() {
+		// to sleep well
+		panic("there is no next node")
+	}
+
+	if it.index.valid() {
+		cmp := -1
+		if it.base.valid() {
+			cmp = it.compare(it.index.key(), it.base.key())
+		}
+
+		if cmp <= 0 {
+			if cmp == 0 {
+				// the pending change overrides the value of the tree
+				it.base.next()
+			}
+
+			key, position, _ := it.index.entry()
+			it.index.next()
+
+			return key, it.writes[position].value
+		}
+	}
+
+	key, value, _ := it.base.entry()
+	it.base.next()
+
+	return key, value
+}
+
+// Close stops the iteration before it is over, so HasNext returns false.
+// See TreeIterator.Close for the details.
+func (it *TreeTxnIterator[K, V]) Close() {
+	it.base.close()
+	it.index.close()
+}
+
+// skipDeleted skips the tombstones that go before the next key of the tree
+// and the keys of the tree deleted by them.
+func (it *TreeTxnIterator[K, V]) skipDeleted() {
+	for it.index.valid() {
+		key, position, _ := it.index.entry()
+		if !it.writes[position].deleted {
+			return
+		}
+
+		if it.base.valid() {
+			cmp := it.compare(key, it.base.key())
+			if cmp > 0 {
+				// the key of the tree goes first
+				return
+			}
+
+			if cmp == 0 {
+				it.base.next()
+			}
+		}
+
+		it.index.next()
+	}
+}
@@ -0,0 +1,155 @@
+package bptree
+
+import (
+	"fmt"
+	"math/rand"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func ExampleTree_Begin() {
+	tree, _ := New()
+	tree.Put([]byte("apple"), []byte("sweet"))
+	tree.Put([]byte("banana"), []byte("honey"))
+
+	txn := tree.Begin()
+	txn.Put([]byte("cinnamon"), []byte("spicy"))
+	txn.Delete([]byte("apple"))
+
+	for it := txn.Iterator(); it.HasNext(); {
+		key, value := it.Next()
+		fmt.Printf("txn: key = %s, value = %s\n", string(key), string(value))
+	}
+	fmt.Printf("tree before commit: %d keys\n", tree.Size())
+
+	txn.Commit()
+	fmt.Printf("tree after commit: %d keys\n", tree.Size())
+
+	// Output:
+	// txn: key = banana, value = honey
+	// txn: key = cinnamon, value = spicy
+	// tree before commit: 2 keys
+	// tree after commit: 2 keys
+}
+
+func TestTxnCommitAndRollbackRandomized(t *testing.T) {
+	for order := 3; order <= 7; order++ {
+		tree, _ := NewTree[int, int](Order(order))
+		expected := make(map[int]int)
+
+		r := rand.New(rand.NewSource(int64(order)))
+		for round := 0; round < 50; round++ {
+			txn := tree.Begin()
+			pending := make(map[int]int)
+			for key, value := range expected {
+				pending[key] = value
+			}
+
+			for i := 0; i < 100; i++ {
+				key := r.Intn(200)
+				expectedValue, expectedOK := pending[key]
+
+				switch r.Intn(3) {
+				case 0:
+					value, ok := txn.Delete(key)
+					if value != expectedValue || ok != expectedOK {
+						t.Fatalf("deleted %d, %v, but expected %d, %v", value, ok, expectedValue, expectedOK)
+					}
+					delete(pending, key)
+				case 1:
+					value, ok := txn.Put(key, round*1000+i)
+					if value != expectedValue || ok != expectedOK {
+						t.Fatalf("overridden %d, %v, but expected %d, %v", value, ok, expectedValue, expectedOK)
+					}
+					pending[key] = round*1000 + i
+				default:
+					value, ok := txn.Get(key)
+					if value != expectedValue || ok != expectedOK {
+						t.Fatalf("got %d, %v, but expected %d, %v", value, ok, expectedValue, expectedOK)
+					}
+				}
+			}
+
+			assertTxnIterator(t, txn, pending)
+
+			// the tree is not changed until the commit
+			snapshot, _ := tree.Snapshot()
+			assertSnapshot(t, snapshot, expected)
+
+			if r.Intn(2) == 0 {
+				if err := txn.Commit(); err != nil {
+					t.Fatal(err)
+				}
+				expected = pending
+			} else {
+				if err := txn.Rollback(); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			assertInvariants(t, tree)
+			snapshot, _ = tree.Snapshot()
+			assertSnapshot(t, snapshot, expected)
+		}
+	}
+}
+
+func TestTxnFinished(t *testing.T) {
+	tree, _ := New()
+
+	txn := tree.Begin()
+	if err := txn.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if err := txn.Commit(); err == nil {
+		t.Fatal("must return an error for the committed transaction, but it does not")
+	}
+	if err := txn.Rollback(); err == nil {
+		t.Fatal("must return an error for the committed transaction, but it does not")
+	}
+}
+
+func TestTxnIteratorPanics(t *testing.T) {
+	tree, _ := New()
+	tree.Put([]byte{1}, []byte{1})
+
+	txn := tree.Begin()
+	txn.Delete([]byte{1})
+
+	it := txn.Iterator()
+	if it.HasNext() {
+		t.Fatal("the deleted key must not be iterated")
+	}
+
+	defer func() {
+		if r := recover(); r == nil {
+			t.Error("Next must panic after the iteration is finished")
+		}
+	}()
+	it.Next()
+}
+
+// assertTxnIterator checks that the transaction iterates exactly over the expected keys and values.
+func assertTxnIterator(t *testing.T, txn *TreeTxn[int, int], expected map[int]int) {
+	t.Helper()
+
+	keys := make([]int, 0, len(expected))
+	for key := range expected {
+		keys = append(keys, key)
+	}
+	sort.Ints(keys)
+
+	actual := make([]int, 0)
+	for it := txn.Iterator(); it.HasNext(); {
+		key, value := it.Next()
+		if value != expected[key] {
+			t.Fatalf("expected %d for %d, but got %d", expected[key], key, value)
+		}
+		actual = append(actual, key)
+	}
+
+	if !reflect.DeepEqual(keys, actual) {
+		t.Fatalf("%v != %v", keys, actual)
+	}
+}
@@ -0,0 +1,471 @@
+package bptree
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// The log of the logged tree is a sequence of records, and each record
+// is a batch of changes applied atomically. All numbers are little-endian.
+//
+//	offset  size  field
+//	0       4     payload length
+//	4       4     CRC-32 (IEEE) of the payload
+//	8             payload
+//
+// The payload is a sequence of changes, each of them starts with its type:
+// 1 for Put followed by the key and the value, 2 for Delete followed by the key,
+// and 3 for DeleteRange followed by the start and the end keys. The keys
+// and the values are prefixed by their uvarint length.
+//
+// The record that is cut short or does not match its checksum is torn,
+// since the process crashed while writing it, so it and the rest of the log
+// are discarded on replay. The checkpoint file next to the log has the same
+// format and keeps the contents of the tree as of the last checkpoint.
+const (
+	recordHeaderSize = 8
+
+	defaultSyncInterval = time.Second
+)
+
+// the types of the logged changes
+const (
+	putChange byte = iota + 1
+	deleteChange
+	deleteRangeChange
+)
+
+// SyncMode determines when the logged tree flushes its log to the disk.
+type SyncMode int
+
+const (
+	// SyncEveryWrite flushes the log after every change, so no acknowledged
+	// change is lost on a crash. This is the default.
+	SyncEveryWrite SyncMode = iota
+
+	// SyncPeriodically flushes the log in the background every SyncInterval,
+	// so the changes of the last interval might be lost on a crash.
+	SyncPeriodically
+
+	// SyncNever leaves flushing the log to the operating system,
+	// so only the changes written before a process crash survive it.
+	SyncNever
+)
+
+// Sync sets when the logged tree flushes its log to the disk.
+func Sync(mode SyncMode) Option {
+	return func(o *options) error {
+		if mode < SyncEveryWrite || mode > SyncNever {
+			return fmt.Errorf("unknown sync mode %d", mode)
+		}
+
+		o.syncMode = mode
+
+		return nil
+	}
+}
+
+// SyncInterval sets the interval between the flushes of the log
+// in the SyncPeriodically mode. The default is one second.
+func SyncInterval(interval time.Duration) Option {
+	return func(o *options) error {
+		if interval <= 0 {
+			return fmt.Errorf("sync interval must be > 0")
+		}
+
+		o.syncInterval = interval
+
+		return nil
+	}
+}
+
+// OpenLogged returns the in-memory tree that appends every change
+// to the write-ahead log at the path before it applies the change,
+// so the tree survives a crash of the process. It restores the tree from
+// the last checkpoint and replays the log, and the torn record at the end
+// of the log, if any, is truncated.
+//
+// Put, Delete, DeleteRange and the commits of the transactions are logged,
+// the versions returned by With and Without are not. Checkpoint truncates
+// the log, and Close flushes and closes it. If writing the log fails,
+// the change is not applied, and the tree refuses all further changes,
+// since the log might have lost them. The error is returned by Err,
+// Commit, Checkpoint and Close, and the tree must be opened again.
+func OpenLogged(path string, options ...Option) (*BPTree, error) {
+	o, err := newOptions(options)
+	if err != nil {
+		return nil, err
+	}
+
+	t, err := newBPTree(o)
+	if err != nil {
+		return nil, err
+	}
+
+	err = t.openLog(path, o)
+	if err != nil {
+		// the tree that spills its nodes removes its scratch file
+		t.Close()
+
+		return nil, err
+	}
+
+	return t, nil
+}
+
+// openLog restores the tree from the checkpoint and the log at the path
+// and opens the log for appending.
+func (t *BPTree) openLog(path string, o *options) error {
+	l := &writeAheadLog[[]byte, []byte]{path: path, codec: bytesCodec, mode: o.syncMode}
+
+	checkpoint, err := os.ReadFile(l.checkpointPath())
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if valid, err := l.replay(t.Tree, checkpoint); err != nil || valid != len(checkpoint) {
+		return fmt.Errorf("checkpoint is corrupted")
+	}
+
+	b, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	valid, err := l.replay(t.Tree, b)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+
+	// the torn record is discarded, so the next records
+	// are appended right after the last valid one
+	err = file.Truncate(int64(valid))
+	if err != nil {
+		file.Close()
+
+		return err
+	}
+
+	l.file, l.size = file, int64(valid)
+	t.log = l
+
+	if o.syncMode == SyncPeriodically {
+		l.stop, l.stopped = make(chan struct{}), make(chan struct{})
+		go l.syncPeriodically(o.syncInterval)
+	}
+
+	return nil
+}
+
+// Checkpoint writes the contents of the logged tree to the checkpoint file
+// next to the log and truncates the log, so the log does not grow without
+// bound and the tree is restored faster. Returns the error of writing the log
+// without writing the checkpoint if the tree refuses changes.
+func (t *BPTree) Checkpoint() error {
+	if t.log == nil {
+		return fmt.Errorf("tree is not logged")
+	}
+
+	return t.log.checkpoint(t.Tree)
+}
+
+// Err returns the first error of writing the log of the logged tree,
+// or of reading the pages of the tree that stores its nodes in a file,
+// after which the tree refuses all changes. Returns nil for the other trees.
+func (t *BPTree) Err() error {
+	if t.log == nil {
+		return t.storeErr()
+	}
+
+	return t.log.error()
+}
+
+// logFile is the file of the log, which the tests replace
+// to make writing it fail.
+type logFile interface {
+	Write(b []byte) (int, error)
+	Sync() error
+	Truncate(size int64) error
+	Close() error
+}
+
+// writeAheadLog appends the changes of the tree to the log file.
+type writeAheadLog[K, V any] struct {
+	file  logFile
+	path  string
+	codec codec[K, V]
+	mode  SyncMode
+
+	// the buffer of the record being written
+	record []byte
+
+	// the size of the log up to the end of the last written record
+	size int64
+
+	// stop stops the background flushes, which close stopped when they stop
+	stop    chan struct{}
+	stopped chan struct{}
+
+	// the first error of writing the log, which might be set
+	// by the background flushes as well. The tree refuses changes after it.
+	mu  sync.Mutex
+	err error
+}
+
+// checkpointPath returns the path of the checkpoint file.
+func (l *writeAheadLog[K, V]) checkpointPath() string {
+	return l.path + ".checkpoint"
+}
+
+// appendPut appends the logged Put to the payload.
+func (l *writeAheadLog[K, V]) appendPut(b []byte, key K, value V) []byte {
+	b = append(b, putChange)
+	b = l.codec.appendKey(b, key)
+
+	return l.codec.appendValue(b, value)
+}
+
+// appendDelete appends the logged Delete to the payload.
+func (l *writeAheadLog[K, V]) appendDelete(b []byte, key K) []byte {
+	b = append(b, deleteChange)
+
+	return l.codec.appendKey(b, key)
+}
+
+// appendDeleteRange appends the logged DeleteRange to the payload.
+func (l *writeAheadLog[K, V]) appendDeleteRange(b []byte, start, end K) []byte {
+	b = append(b, deleteRangeChange)
+	b = l.codec.appendKey(b, start)
+
+	return l.codec.appendKey(b, end)
+}
+
+// write appends the record with the payload to the log and flushes it
+// in the SyncEveryWrite mode. If it fails, the record is cut off the log,
+// so it is not replayed, and the change must not be applied. The log is not
+// written after the first error.
+func (l *writeAheadLog[K, V]) write(payload []byte) error {
+	if err := l.error(); err != nil {
+		return err
+	}
+
+	l.record = appendRecord(l.record[:0], payload)
+
+	_, err := l.file.Write(l.record)
+	if err == nil && l.mode == SyncEveryWrite {
+		err = l.file.Sync()
+	}
+	if err != nil {
+		l.file.Truncate(l.size)
+		l.fail(err)
+
+		return err
+	}
+
+	l.size += int64(len(l.record))
+
+	return nil
+}
+
+// error returns the first error of writing the log.
+func (l *writeAheadLog[K, V]) error() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.err
+}
+
+// fail keeps the first error of writing the log.
+func (l *writeAheadLog[K, V]) fail(err error) {
+	l.mu.Lock()
+	l.err = firstError(l.err, err)
+	l.mu.Unlock()
+}
+
+// syncPeriodically flushes the log every interval until the log is closed.
+func (l *writeAheadLog[K, V]) syncPeriodically(interval time.Duration) {
+	defer close(l.stopped)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			l.fail(l.file.Sync())
+		case <-l.stop:
+			return
+		}
+	}
+}
+
+// checkpoint writes the contents of the tree to a temporary file, which
+// replaces the checkpoint file only when it is completely written and
+// flushed with its directory, and truncates the log. A crash before the truncation leaves both the new
+// checkpoint and the old log, which is safe to replay again, since
+// the replay of the changes ends up in the same state.
+func (l *writeAheadLog[K, V]) checkpoint(t *Tree[K, V]) error {
+	if err := l.error(); err != nil {
+		return err
+	}
+
+	temporary := l.checkpointPath() + ".tmp"
+	file, err := os.Create(temporary)
+	if err != nil {
+		return err
+	}
+
+	w := bufio.NewWriter(file)
+	var record []byte
+	t.ForEach(func(key K, value V) {
+		if err == nil {
+			record = appendRecord(record[:0], l.appendPut(nil, key, value))
+			_, err = w.Write(record)
+		}
+	})
+
+	if err == nil {
+		err = w.Flush()
+	}
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(temporary, l.checkpointPath())
+	}
+	if err != nil {
+		os.Remove(temporary)
+
+		return err
+	}
+
+	// the log is truncated only when the rename is on the disk, otherwise
+	// a power loss might keep the truncation and lose the new checkpoint
+	err = syncDirectory(l.checkpointPath())
+	if err == nil {
+		err = l.file.Truncate(0)
+	}
+	if err == nil {
+		l.size = 0
+		err = l.file.Sync()
+	}
+
+	return err
+}
+
+// syncDirectory flushes the directory of the file, so the files created
+// in it or renamed into it survive a crash of the system.
+func syncDirectory(path string) error {
+	dir, err := os.Open(filepath.Dir(path))
+	if err != nil {
+		return err
+	}
+
+	return firstError(dir.Sync(), dir.Close())
+}
+
+// close stops the background flushes, flushes and closes the log
+// and returns the first error of writing it.
+func (l *writeAheadLog[K, V]) close() error {
+	if l.stop != nil {
+		close(l.stop)
+		<-l.stopped
+	}
+
+	l.fail(l.file.Sync())
+	l.fail(l.file.Close())
+
+	return l.error()
+}
+
+// replay applies the records of the log to the tree and returns the length
+// of the valid records. The replay stops at the first torn record.
+func (l *writeAheadLog[K, V]) replay(t *Tree[K, V], b []byte) (int, error) {
+	valid := 0
+	for len(b)-valid >= recordHeaderSize {
+		length := int(binary.LittleEndian.Uint32(b[valid:]))
+		checksum := binary.LittleEndian.Uint32(b[valid+4:])
+
+		start := valid + recordHeaderSize
+		if length > len(b)-start || crc32.ChecksumIEEE(b[start:start+length]) != checksum {
+			break
+		}
+
+		err := l.apply(t, b[start:start+length])
+		if err != nil {
+			return 0, err
+		}
+
+		valid = start + length
+	}
+
+	return valid, nil
+}
+
+// loggedChange is a change decoded from the record.
+type loggedChange[K, V any] struct {
+	kind     byte
+	key, end K
+	value    V
+}
+
+// apply decodes all changes of the record and only then applies them,
+// so the record is applied atomically.
+func (l *writeAheadLog[K, V]) apply(t *Tree[K, V], payload []byte) error {
+	changes := make([]loggedChange[K, V], 0, 1)
+	for len(payload) > 0 {
+		c := loggedChange[K, V]{kind: payload[0]}
+
+		var err error
+		c.key, payload, err = l.codec.readKey(payload[1:])
+		switch {
+		case err != nil:
+		case c.kind == putChange:
+			c.value, payload, err = l.codec.readValue(payload)
+		case c.kind == deleteRangeChange:
+			c.end, payload, err = l.codec.readKey(payload)
+		case c.kind != deleteChange:
+			err = fmt.Errorf("unknown change type %d", c.kind)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to decode the log record: %w", err)
+		}
+
+		changes = append(changes, c)
+	}
+
+	for _, c := range changes {
+		switch c.kind {
+		case putChange:
+			t.Put(c.key, c.value)
+		case deleteChange:
+			t.Delete(c.key)
+		default:
+			t.DeleteRange(c.key, c.end)
+		}
+	}
+
+	return nil
+}
+
+// appendRecord appends the header of the record and the payload.
+func appendRecord(b []byte, payload []byte) []byte {
+	b = binary.LittleEndian.AppendUint32(b, uint32(len(payload)))
+	b = binary.LittleEndian.AppendUint32(b, crc32.ChecksumIEEE(payload))
+
+	return append(b, payload...)
+}
@@ -0,0 +1,397 @@
+package bptree
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func ExampleOpenLogged() {
+	path := filepath.Join(os.TempDir(), "fruits.log")
+	defer os.Remove(path)
+	defer os.Remove(path + ".checkpoint")
+
+	tree, _ := OpenLogged(path)
+	tree.Put([]byte("apple"), []byte("sweet"))
+	tree.Checkpoint()
+	tree.Put([]byte("banana"), []byte("honey"))
+	// the process crashes here, so the tree is not closed
+
+	tree, _ = OpenLogged(path)
+	defer tree.Close()
+
+	tree.ForEach(func(key, value []byte) {
+		fmt.Printf("%s = %s\n", key, value)
+	})
+	// Output:
+	// apple = sweet
+	// banana = honey
+}
+
+func TestOpenLoggedErrors(t *testing.T) {
+	dir := t.TempDir()
+
+	if _, err := OpenLogged(filepath.Join(dir, "log"), Sync(SyncMode(3))); err == nil {
+		t.Error("expected the sync mode error")
+	}
+	if _, err := OpenLogged(filepath.Join(dir, "log"), SyncInterval(0)); err == nil {
+		t.Error("expected the sync interval error")
+	}
+	if _, err := OpenLogged(filepath.Join(dir, "log"), Comparator(func(x, y int) int { return x - y })); err == nil {
+		t.Error("expected the comparator error")
+	}
+
+	// the log is a directory
+	if _, err := OpenLogged(dir); err == nil {
+		t.Error("expected the error for the directory")
+	}
+
+	// the log can not be created
+	if _, err := OpenLogged(filepath.Join(dir, "missing", "log")); err == nil {
+		t.Error("expected the error for the missing directory")
+	}
+
+	// the checkpoint is a directory
+	os.Mkdir(filepath.Join(dir, "directory.checkpoint"), 0755)
+	if _, err := OpenLogged(filepath.Join(dir, "directory")); err == nil {
+		t.Error("expected the error for the directory")
+	}
+
+	// the log can not be truncated
+	if _, err := OpenLogged(os.DevNull); err == nil {
+		t.Error("expected the truncation error")
+	}
+
+	// the checkpoint is written at once, so it can not be torn
+	os.WriteFile(filepath.Join(dir, "torn.checkpoint"), appendRecord(nil, []byte{putChange})[:5], 0644)
+	if _, err := OpenLogged(filepath.Join(dir, "torn")); err == nil {
+		t.Error("expected the checkpoint error")
+	}
+
+	// the directory of the checkpoint can not be flushed
+	if err := syncDirectory(filepath.Join(dir, "missing", "log")); err == nil {
+		t.Error("expected the error for the missing directory")
+	}
+
+	// the records with the valid checksums can not be decoded
+	for i, payload := range [][]byte{{putChange}, {putChange, 0}, {deleteRangeChange, 0}, {4, 0}} {
+		path := filepath.Join(dir, fmt.Sprintf("malformed-%d", i))
+		os.WriteFile(path, appendRecord(nil, payload), 0644)
+		if _, err := OpenLogged(path); err == nil {
+			t.Errorf("expected the error for payload %v", payload)
+		}
+	}
+}
+
+func TestOpenLoggedRemovesScratchFile(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("TMPDIR", dir)
+
+	path := filepath.Join(dir, "log")
+	os.WriteFile(path+".checkpoint", []byte("corrupted"), 0644)
+	if _, err := OpenLogged(path, MemoryLimit(4096)); err == nil {
+		t.Fatal("expected the checkpoint error")
+	}
+
+	// the scratch file of the tree is removed with the tree
+	scratch, _ := filepath.Glob(filepath.Join(dir, "*.spill"))
+	if len(scratch) != 0 {
+		t.Fatalf("expected the scratch file to be removed, but got %v", scratch)
+	}
+}
+
+func TestLoggedTreeSurvivesTornWrites(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "log")
+
+	tree, err := OpenLogged(path, Order(3), Sync(SyncNever))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the contents of the tree after every record
+	expected := []map[string][]byte{{}}
+	ends := []int64{0}
+
+	r := rand.New(rand.NewSource(1))
+	state := make(map[string][]byte)
+	for i := 0; i < 200; i++ {
+		key := r.Intn(50)
+		switch r.Intn(10) {
+		case 0:
+			end := key + r.Intn(10)
+			tree.DeleteRange(rankKey(key), rankKey(end))
+			for k := key; k < end; k++ {
+				delete(state, string(rankKey(k)))
+			}
+		case 1:
+			// the transaction is logged as one record
+			txn := tree.Begin()
+			txn.Put(rankKey(key), []byte("txn"))
+			txn.Delete(rankKey(key + 1))
+			txn.Commit()
+			state[string(rankKey(key))] = []byte("txn")
+			delete(state, string(rankKey(key+1)))
+		case 2, 3, 4:
+			tree.Delete(rankKey(key))
+			delete(state, string(rankKey(key)))
+		default:
+			value := bytes.Repeat([]byte{byte(i)}, r.Intn(20))
+			tree.Put(rankKey(key), value)
+			state[string(rankKey(key))] = value
+		}
+
+		info, _ := os.Stat(path)
+		ends = append(ends, info.Size())
+		expected = append(expected, clone(state))
+	}
+	if err := tree.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	log, _ := os.ReadFile(path)
+	for size := 0; size <= len(log); size++ {
+		// the crash in the middle of the record cuts it short
+		torn := filepath.Join(dir, fmt.Sprintf("torn-%d", size))
+		os.WriteFile(torn, log[:size], 0644)
+
+		last := 0
+		for i, end := range ends {
+			if end <= int64(size) {
+				last = i
+			}
+		}
+
+		tree, err := OpenLogged(torn, Order(3))
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertContents(t, tree, expected[last])
+
+		// the torn record is truncated, so the new records follow the valid ones
+		tree.Put([]byte("after"), []byte("crash"))
+		tree.Close()
+
+		tree, _ = OpenLogged(torn, Order(3))
+		if value, ok := tree.Get([]byte("after")); !ok || string(value) != "crash" {
+			t.Fatalf("expected the record after the torn one, but got %s, %v", value, ok)
+		}
+		tree.Close()
+	}
+
+	// the corrupted record and all records after it are discarded
+	corrupted := filepath.Join(dir, "corrupted")
+	log[ends[100]+recordHeaderSize] ^= 0xff
+	os.WriteFile(corrupted, log, 0644)
+
+	tree, _ = OpenLogged(corrupted, Order(3))
+	assertContents(t, tree, expected[100])
+	tree.Close()
+}
+
+func TestLoggedTreeCheckpoint(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "log")
+
+	tree, _ := OpenLogged(path, Order(4))
+	expected := make(map[string][]byte)
+	for i := 0; i < 100; i++ {
+		tree.Put(rankKey(i), rankKey(i))
+		expected[string(rankKey(i))] = rankKey(i)
+	}
+
+	if err := tree.Checkpoint(); err != nil {
+		t.Fatal(err)
+	}
+	if info, _ := os.Stat(path); info.Size() != 0 {
+		t.Fatalf("expected the truncated log, but got %d bytes", info.Size())
+	}
+
+	for i := 50; i < 150; i++ {
+		tree.Delete(rankKey(i))
+		delete(expected, string(rankKey(i)))
+	}
+	tree.PopMin()
+	delete(expected, string(rankKey(0)))
+
+	// the versions are not logged
+	tree.With([]byte("version"), nil)
+
+	// the crash before the truncation of the log replays it again
+	// over the new checkpoint, which results in the same state
+	log, _ := os.ReadFile(path)
+	if err := tree.Checkpoint(); err != nil {
+		t.Fatal(err)
+	}
+	os.WriteFile(path, log, 0644)
+
+	tree, _ = OpenLogged(path, Order(4))
+	assertContents(t, tree, expected)
+	tree.Close()
+
+	tree, _ = New()
+	if err := tree.Checkpoint(); err == nil {
+		t.Fatal("expected the error for the tree that is not logged")
+	}
+}
+
+func TestLoggedTreeSyncPeriodically(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "log")
+
+	tree, _ := OpenLogged(path, Sync(SyncPeriodically), SyncInterval(time.Millisecond))
+	tree.Put([]byte("apple"), []byte("sweet"))
+	time.Sleep(10 * time.Millisecond)
+
+	if err := tree.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	tree, _ = OpenLogged(path, Sync(SyncPeriodically), SyncInterval(time.Millisecond))
+	if _, ok := tree.Get([]byte("apple")); !ok {
+		t.Fatal("the logged key is not found")
+	}
+
+	// the background flushes fail after the file is closed
+	tree.log.file.Close()
+	time.Sleep(10 * time.Millisecond)
+	if err := tree.Close(); err == nil {
+		t.Fatal("expected the sync error")
+	}
+}
+
+func TestLoggedTreeWriteErrors(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "log")
+
+	tree, _ := OpenLogged(path)
+	tree.Put([]byte("apple"), []byte("sweet"))
+
+	// the checkpoint is not written over the directory, and the log is kept
+	os.Mkdir(path+".checkpoint.tmp", 0755)
+	if err := tree.Checkpoint(); err == nil {
+		t.Fatal("expected the checkpoint error")
+	}
+	os.Remove(path + ".checkpoint.tmp")
+
+	os.MkdirAll(filepath.Join(path+".checkpoint", "directory"), 0755)
+	if err := tree.Checkpoint(); err == nil {
+		t.Fatal("expected the checkpoint error")
+	}
+	if _, err := os.Stat(path + ".checkpoint.tmp"); !os.IsNotExist(err) {
+		t.Fatal("expected the temporary checkpoint to be removed")
+	}
+	os.RemoveAll(path + ".checkpoint")
+
+	// the log can not be written after the file is closed
+	tree.log.file.Close()
+	tree.Put([]byte("banana"), []byte("honey"))
+	if err := tree.Err(); err == nil {
+		t.Fatal("expected the write error")
+	}
+	if err := tree.Checkpoint(); err == nil {
+		t.Fatal("expected the write error")
+	}
+	if err := tree.Close(); err == nil {
+		t.Fatal("expected the write error")
+	}
+
+	// the change that is not logged is not applied
+	tree, _ = OpenLogged(path)
+	assertContents(t, tree, map[string][]byte{"apple": []byte("sweet")})
+	tree.Close()
+
+	// the truncation of the log fails after the file is closed
+	tree, _ = OpenLogged(path)
+	tree.log.file.Close()
+	if err := tree.Checkpoint(); err == nil {
+		t.Fatal("expected the truncation error")
+	}
+	tree.Close()
+
+	tree, _ = New()
+	if err := tree.Err(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoggedTreeRefusesChangesAfterWriteError(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "log")
+
+	tree, _ := OpenLogged(path)
+	tree.Put([]byte("apple"), []byte("sweet"))
+	tree.Put([]byte("banana"), []byte("honey"))
+
+	// the missing key is not logged
+	info, _ := os.Stat(path)
+	tree.Delete([]byte("cherry"))
+	tree.DeleteRange([]byte("cherry"), []byte("apple"))
+	txn := tree.Begin()
+	txn.Delete([]byte("cherry"))
+	txn.Commit()
+	if actual, _ := os.Stat(path); actual.Size() != info.Size() {
+		t.Fatalf("expected %d bytes of the log, but got %d", info.Size(), actual.Size())
+	}
+
+	// the record that is written but not flushed is cut off the log
+	file := &failingFile{File: tree.log.file.(*os.File)}
+	tree.log.file = file
+	file.failSync = true
+	if _, ok := tree.Put([]byte("apple"), []byte("sour")); ok {
+		t.Fatal("expected the change to be refused")
+	}
+	file.failSync = false
+
+	tree.Put([]byte("cherry"), []byte("red"))
+	tree.Delete([]byte("apple"))
+	tree.DeleteRange([]byte("a"), []byte("z"))
+	txn = tree.Begin()
+	txn.Put([]byte("cherry"), []byte("red"))
+	if err := txn.Commit(); err == nil {
+		t.Fatal("expected the write error")
+	}
+	if _, _, ok := tree.PopMin(); ok {
+		t.Fatal("expected the change to be refused")
+	}
+	if _, _, ok := tree.PopMax(); ok {
+		t.Fatal("expected the change to be refused")
+	}
+
+	expected := map[string][]byte{"apple": []byte("sweet"), "banana": []byte("honey")}
+	assertContents(t, tree, expected)
+	if actual, _ := os.Stat(path); actual.Size() != info.Size() {
+		t.Fatalf("expected %d bytes of the log, but got %d", info.Size(), actual.Size())
+	}
+	if err := tree.Close(); err == nil {
+		t.Fatal("expected the write error")
+	}
+
+	tree, _ = OpenLogged(path)
+	assertContents(t, tree, expected)
+	tree.Close()
+}
+
+// failingFile is the file of the log that fails to flush on demand.
+type failingFile struct {
+	*os.File
+	failSync bool
+}
+
+func (f *failingFile) Sync() error {
+	if f.failSync {
+		return fmt.Errorf("failed")
+	}
+
+	return f.File.Sync()
+}
+
+func clone(m map[string][]byte) map[string][]byte {
+	c := make(map[string][]byte, len(m))
+	for key, value := range m {
+		c[key] = value
+	}
+
+	return c
+}